@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+const (
+	maxAPIKeysPerUser   = 25
+	maxAPIKeyNameLength = 100
+	// apiKeyDisplayLength is how much of a key is kept in the clear so
+	// users can tell their keys apart.
+	apiKeyDisplayLength = len(auth.APIKeyPrefix) + 8
+)
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDB(key database.ApiKey) APIKey {
+	res := APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt.Valid {
+		res.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		res.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return res
+}
+
+// pgAPIKeyStore looks API keys up in Postgres for auth.Middleware and notes
+// when each last authenticated a request.
+type pgAPIKeyStore struct {
+	db *database.Queries
+}
+
+func (s pgAPIKeyStore) LookupAPIKey(ctx context.Context, keyHash string) (auth.APIKey, error) {
+	row, err := s.db.GetActiveAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.APIKey{}, auth.ErrAPIKeyInvalid
+		}
+		return auth.APIKey{}, err
+	}
+	key := auth.APIKey{
+		ID:     row.ID,
+		UserID: row.UserID,
+		Role:   row.Role,
+		Scopes: row.Scopes,
+	}
+	if row.ExpiresAt.Valid {
+		key.ExpiresAt = row.ExpiresAt.Time
+	}
+	return key, nil
+}
+
+func (s pgAPIKeyStore) RecordAPIKeyUse(ctx context.Context, keyID uuid.UUID) {
+	if err := s.db.TouchAPIKey(ctx, keyID); err != nil {
+		log.Printf("Error recording API key use: %v", err)
+	}
+}
+
+// createAPIKeyHandler issues a named API key. The key itself is only in this
+// response; afterwards only its prefix is shown.
+func (cfg *apiConfig) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	if params.Name == "" || len(params.Name) > maxAPIKeyNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("name is required and must be at most %d characters", maxAPIKeyNameLength))
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !auth.ValidScope(scope) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope %q", scope))
+			return
+		}
+	}
+	slices.Sort(params.Scopes)
+	params.Scopes = slices.Compact(params.Scopes)
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	userID := currentUserID(r)
+	count, err := cfg.db.CountActiveAPIKeys(r.Context(), userID)
+	if err != nil {
+		errorString := "Error when attempting to create API key"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if count >= maxAPIKeysPerUser {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d API keys, revoke one first", maxAPIKeysPerUser))
+		return
+	}
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		errorString := "Error when attempting to create API key"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	row, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      params.Name,
+		KeyHash:   auth.HashOpaqueToken(key),
+		Prefix:    key[:apiKeyDisplayLength],
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		errorString := "Error when attempting to create API key"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	res := apiKeyFromDB(row)
+	res.Key = key
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+func (cfg *apiConfig) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := cfg.db.ListAPIKeys(r.Context(), currentUserID(r))
+	if err != nil {
+		errorString := "Error when attempting to retrieve API keys"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	keys := make([]APIKey, len(rows))
+	for i, row := range rows {
+		keys[i] = apiKeyFromDB(row)
+	}
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (cfg *apiConfig) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID format")
+		return
+	}
+	revoked, err := cfg.db.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: currentUserID(r),
+	})
+	if err != nil {
+		errorString := "Error when attempting to revoke API key"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// Cursor kinds name the listing a cursor was issued by. A position in one
+// listing means nothing in another, so cursors only work where they came from.
+const (
+	cursorChirps    = "chirps"
+	cursorTimeline  = "timeline"
+	cursorTags      = "tags"
+	cursorMentions  = "mentions"
+	cursorFollowers = "followers"
+	cursorFollowing = "following"
+)
+
+// chirpCursor marks a position in a list of chirps ordered by created_at and
+// then id, in the direction the list was sorted. Clients only ever see it in
+// its encoded, opaque form.
+type chirpCursor struct {
+	Kind       string
+	Descending bool
+	CreatedAt  time.Time
+	ID         uuid.UUID
+}
+
+type chirpPageRequest struct {
+	Kind       string
+	Limit      int32
+	Descending bool
+	Cursor     *chirpCursor
+}
+
+type ChirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func encodeCursor(c chirpCursor) string {
+	direction := "asc"
+	if c.Descending {
+		direction = "desc"
+	}
+	raw := c.Kind + "|" + direction + "|" + c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, errors.New("Invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 4)
+	if len(parts) != 4 || parts[0] == "" || (parts[1] != "asc" && parts[1] != "desc") {
+		return chirpCursor{}, errors.New("Invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[2])
+	if err != nil {
+		return chirpCursor{}, errors.New("Invalid cursor")
+	}
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		return chirpCursor{}, errors.New("Invalid cursor")
+	}
+	return chirpCursor{Kind: parts[0], Descending: parts[1] == "desc", CreatedAt: createdAt, ID: id}, nil
+}
+
+// parsePageRequest reads the limit and cursor query parameters shared by every
+// cursor paginated listing. kind names the listing and descending is the
+// order it is sorted in; a cursor from another listing, or from this one
+// sorted the other way, would skip or repeat entries, so it is rejected.
+func parsePageRequest(r *http.Request, kind string, descending bool) (chirpPageRequest, error) {
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		return chirpPageRequest{}, err
+	}
+	page := chirpPageRequest{Kind: kind, Limit: limit, Descending: descending}
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		if err != nil {
+			return chirpPageRequest{}, err
+		}
+		if cursor.Kind != kind {
+			return chirpPageRequest{}, errors.New("Cursor is for a different listing")
+		}
+		if cursor.Descending != descending {
+			return chirpPageRequest{}, errors.New("Cursor is for a different sort order")
+		}
+		page.Cursor = &cursor
+	}
+	return page, nil
+}
+
+// parsePageLimit reads the limit query parameter, clamping it to
+// maxPageLimit.
+func parsePageLimit(r *http.Request) (int32, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return int32(limit), nil
+}
+
+func (p chirpPageRequest) cursorCreatedAt() sql.NullTime {
+	if p.Cursor == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}
+}
+
+func (p chirpPageRequest) cursorID() uuid.NullUUID {
+	if p.Cursor == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+// newChirpPage trims the one extra row every listing query fetches and uses
+// its presence to decide whether there is a next page.
+func newChirpPage(chirps []Chirp, req chirpPageRequest) ChirpPage {
+	page := ChirpPage{Chirps: chirps}
+	if len(chirps) > int(req.Limit) {
+		page.Chirps = chirps[:req.Limit]
+		last := page.Chirps[len(page.Chirps)-1]
+		next := encodeCursor(chirpCursor{Kind: req.Kind, Descending: req.Descending, CreatedAt: last.CreatedAt, ID: last.ID})
+		page.NextCursor = &next
+	}
+	return page
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := chirpCursor{
+		Kind:       cursorFollowers,
+		Descending: true,
+		CreatedAt:  time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC),
+		ID:         uuid.New(),
+	}
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Kind != want.Kind || got.Descending != want.Descending || !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	createdAt := "2024-05-01T12:30:00Z"
+	id := uuid.NewString()
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"bad base64", "not*base64"},
+		{"too few fields", encode("desc|" + createdAt + "|" + id)},
+		{"too many fields", encode("chirps|desc|" + createdAt + "|" + id + "|extra")},
+		{"missing kind", encode("|desc|" + createdAt + "|" + id)},
+		{"unknown direction", encode("chirps|sideways|" + createdAt + "|" + id)},
+		{"bad time", encode("chirps|desc|yesterday|" + id)},
+		{"bad id", encode("chirps|desc|" + createdAt + "|not-a-uuid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("expected an error for cursor %q", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	id := uuid.New()
+	chirpsDesc := encodeCursor(chirpCursor{Kind: cursorChirps, Descending: true, CreatedAt: createdAt, ID: id})
+	chirpsAsc := encodeCursor(chirpCursor{Kind: cursorChirps, Descending: false, CreatedAt: createdAt, ID: id})
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		kind       string
+		descending bool
+		wantLimit  int32
+		wantCursor bool
+		wantErr    bool
+	}{
+		{
+			name:      "defaults",
+			query:     url.Values{},
+			kind:      cursorChirps,
+			wantLimit: defaultPageLimit,
+		},
+		{
+			name:      "limit",
+			query:     url.Values{"limit": {"10"}},
+			kind:      cursorChirps,
+			wantLimit: 10,
+		},
+		{
+			name:      "limit clamped",
+			query:     url.Values{"limit": {"500"}},
+			kind:      cursorChirps,
+			wantLimit: maxPageLimit,
+		},
+		{
+			name:    "zero limit",
+			query:   url.Values{"limit": {"0"}},
+			kind:    cursorChirps,
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric limit",
+			query:   url.Values{"limit": {"ten"}},
+			kind:    cursorChirps,
+			wantErr: true,
+		},
+		{
+			name:       "matching cursor",
+			query:      url.Values{"cursor": {chirpsDesc}},
+			kind:       cursorChirps,
+			descending: true,
+			wantLimit:  defaultPageLimit,
+			wantCursor: true,
+		},
+		{
+			name:       "direction mismatch",
+			query:      url.Values{"cursor": {chirpsAsc}},
+			kind:       cursorChirps,
+			descending: true,
+			wantErr:    true,
+		},
+		{
+			name:       "kind mismatch",
+			query:      url.Values{"cursor": {chirpsDesc}},
+			kind:       cursorFollowers,
+			descending: true,
+			wantErr:    true,
+		},
+		{
+			name:    "bad cursor",
+			query:   url.Values{"cursor": {"not*base64"}},
+			kind:    cursorChirps,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+tt.query.Encode(), nil)
+			page, err := parsePageRequest(r, tt.kind, tt.descending)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if page.Limit != tt.wantLimit {
+				t.Errorf("expected limit %d, got %d", tt.wantLimit, page.Limit)
+			}
+			if (page.Cursor != nil) != tt.wantCursor {
+				t.Errorf("expected cursor %v, got %+v", tt.wantCursor, page.Cursor)
+			}
+			if page.Kind != tt.kind || page.Descending != tt.descending {
+				t.Errorf("expected kind %q descending %v, got %q %v", tt.kind, tt.descending, page.Kind, page.Descending)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+// Follow is one entry in a public follower or following list. Email
+// addresses are private, so users appear by ID only.
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowPage struct {
+	Follows    []Follow `json:"follows"`
+	NextCursor *string  `json:"next_cursor"`
+}
+
+// newFollowPage is newChirpPage for follower and following lists, whose
+// cursors point at the follow's created_at and the listed user's ID.
+func newFollowPage(follows []Follow, req chirpPageRequest) FollowPage {
+	page := FollowPage{Follows: follows}
+	if len(follows) > int(req.Limit) {
+		page.Follows = follows[:req.Limit]
+		last := page.Follows[len(page.Follows)-1]
+		next := encodeCursor(chirpCursor{Kind: req.Kind, Descending: req.Descending, CreatedAt: last.FollowedAt, ID: last.UserID})
+		page.NextCursor = &next
+	}
+	return page
+}
+
+// followTarget parses the userID path value and makes sure that user exists.
+func (cfg *apiConfig) followTarget(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return uuid.Nil, false
+	}
+	_, err = cfg.db.GetUserByID(r.Context(), targetID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return uuid.Nil, false
+		}
+		errorString := "Error when attempting to find user"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return uuid.Nil, false
+	}
+	return targetID, true
+}
+
+func (cfg *apiConfig) followHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	targetID, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	if targetID == userID {
+		respondWithError(w, http.StatusBadRequest, "Users cannot follow themselves")
+		return
+	}
+	err := cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		errorString := "Error when attempting to follow user"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unfollowHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	targetID, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+	if err != nil {
+		errorString := "Error when attempting to unfollow user"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// followersHandler lists who follows a user, most recent first, paginated
+// with limit and cursor like the chirp listings.
+func (cfg *apiConfig) followersHandler(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(r, cursorFollowers, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := cfg.db.ListFollowers(r.Context(), database.ListFollowersParams{
+		FolloweeID:      targetID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive followers"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	follows := make([]Follow, len(rows))
+	for i, row := range rows {
+		follows[i] = Follow{
+			UserID:     row.ID,
+			FollowedAt: row.FollowedAt,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, newFollowPage(follows, page))
+}
+
+func (cfg *apiConfig) followingHandler(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := cfg.followTarget(w, r)
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(r, cursorFollowing, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := cfg.db.ListFollowing(r.Context(), database.ListFollowingParams{
+		FollowerID:      targetID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive followed users"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	follows := make([]Follow, len(rows))
+	for i, row := range rows {
+		follows[i] = Follow{
+			UserID:     row.ID,
+			FollowedAt: row.FollowedAt,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, newFollowPage(follows, page))
+}
+
+// timelineHandler returns chirps from everyone the caller follows, newest
+// first, paginated the same way as GET /api/chirps.
+func (cfg *apiConfig) timelineHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	page, err := parsePageRequest(r, cursorTimeline, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dbChirps, err := cfg.db.Timeline(r.Context(), database.TimelineParams{
+		FollowerID:      userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive timeline"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	chirps := make([]Chirp, len(dbChirps))
+	for i, chirp := range dbChirps {
+		chirps[i] = chirpFromDB(chirp)
+	}
+	err = cfg.attachLikesToPage(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newChirpPage(chirps, page))
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes an API key can be granted. Access tokens carry every scope.
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+)
+
+func ValidScope(scope string) bool {
+	return scope == ScopeChirpsRead || scope == ScopeChirpsWrite
+}
+
+// APIKeyPrefix starts every API key so that leaked keys are easy to spot,
+// for example by secret scanners.
+const APIKeyPrefix = "chirpy_"
+
+// MakeAPIKey returns a new random API key. Like refresh tokens, keys are
+// stored as HashOpaqueToken hashes and only shown to the user once.
+func MakeAPIKey() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + token, nil
+}
+
+// APIKey is an active API key as needed to authenticate a request. A zero
+// ExpiresAt means the key does not expire.
+type APIKey struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Role      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// ErrAPIKeyInvalid is returned for keys that do not exist, have been revoked
+// or have expired.
+var ErrAPIKeyInvalid = errors.New("api key is invalid")
+
+// APIKeyStore finds API keys by their HashOpaqueToken hash, returning
+// ErrAPIKeyInvalid for keys that cannot be used. RecordAPIKeyUse is called
+// once a key has authenticated a request; it has no error to return because
+// the request goes ahead either way.
+type APIKeyStore interface {
+	LookupAPIKey(ctx context.Context, keyHash string) (APIKey, error)
+	RecordAPIKeyUse(ctx context.Context, keyID uuid.UUID)
+}
@@ -1,85 +1,165 @@
 package auth
 
 import (
-	"golang.org/x/crypto/bcrypt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
 	"time"
 	"fmt"
+	"errors"
 	"net/http"
 	"strings"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
+// HashPassword hashes password with DefaultPasswordHasher.
 func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashed), nil
+	return DefaultPasswordHasher().Hash(password)
 }
 
+// CheckPasswordHash returns nil if password matches hash, which may come from
+// any algorithm a PasswordHasher supports.
 func CheckPasswordHash(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	_, err := DefaultPasswordHasher().Verify(hash, password)
+	return err
+}
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// Claims are the claims carried by a Chirpy access token. The user's role is
+// included so that handlers can authorise requests without a database query.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claim := jwt.RegisteredClaims{
-		Issuer: "chirpy",
-		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject: userID.String(),
+func MakeJWT(userID uuid.UUID, role string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return NewHMACKeyManager(tokenSecret).MakeJWT(userID, role, expiresIn)
+}
+
+// Access tokens carry their times to the microsecond, the precision Postgres
+// keeps revocation cutoffs at. Whole seconds would make a token issued just
+// after a cutoff look as if it were issued before it.
+func init() {
+	jwt.TimePrecision = time.Microsecond
+}
+
+func newClaims(issuer string, audience []string, userID uuid.UUID, role string, expiresIn time.Duration) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: issuer,
+			Audience: audience,
+			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject: userID.String(),
+			ID: uuid.NewString(),
+		},
+		Role: role,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-	return token.SignedString([]byte(tokenSecret))
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claim := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, &claim, func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil })
-	if err != nil {
-		return uuid.Nil, err
-	}
-	userIDStr, err := token.Claims.GetSubject()
+	claims, err := ParseJWT(tokenString, tokenSecret)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	whoGave, err := token.Claims.GetIssuer()
-	if err != nil {
-		return uuid.Nil, err
-	}
-	if whoGave != "chirpy" {
-		return uuid.Nil, fmt.Errorf("Invalid issuer: %v", whoGave)
-	}
-	id, err := uuid.Parse(userIDStr)
+	return claims.UserID()
+}
+
+// ParseJWT validates an HS256 tokenString and returns its claims.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	return NewValidator(NewHMACKeyManager(tokenSecret)).Validate(tokenString)
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("Invalid user ID: %v", err)
 	}
 	return id, nil
 }
 
-func GetBearerToken(headers http.Header) (string, error) {
+// HasRole reports whether the claims carry any of roles.
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrNoAuthHeader        = errors.New("Error: no authorization in header")
+	ErrMalformedAuthHeader = errors.New("Error: authorization header format must be: Bearer {TOKEN}")
+	ErrNotBearer           = errors.New("Error: authorization header must start with 'Bearer'")
+)
+
+// Schemes accepted in the Authorization header.
+const (
+	SchemeBearer = "Bearer"
+	SchemeAPIKey = "ApiKey"
+)
+
+// GetAuthorization splits the Authorization header into its scheme and
+// credentials.
+func GetAuthorization(headers http.Header) (scheme, credentials string, err error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("Error: no authorization in header")
+		return "", "", ErrNoAuthHeader
 	}
 	authString := strings.Split(authHeader, " ")
 	if len(authString) < 2 {
-		return "", fmt.Errorf("Error: authorization header format must be: Bearer {TOKEN}")
+		return "", "", ErrMalformedAuthHeader
+	}
+	return authString[0], authString[1], nil
+}
+
+func GetBearerToken(headers http.Header) (string, error) {
+	scheme, token, err := GetAuthorization(headers)
+	if err != nil {
+		return "", err
 	}
-	if authString[0] != "Bearer" {
-		return "", fmt.Errorf("Error: authorization header must start with 'Bearer'")
+	if scheme != SchemeBearer {
+		return "", ErrNotBearer
 	}
-	return authString[1], nil
+	return token, nil
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// MakeOpaqueToken returns 32 random bytes hex encoded, for tokens that are
+// looked up in the database rather than verified by signature.
+func MakeOpaqueToken() (string, error) {
 	key := make([]byte, 32)
 	rand.Read(key)
 	if _, err := rand.Read(key); err != nil {
         return "", err
     }
 	return hex.EncodeToString(key), nil
-}
\ No newline at end of file
+}
+
+// HashRefreshToken returns the digest refresh tokens are stored and looked up
+// by. The tokens are random, so an unsalted hash is enough to keep a copy of
+// the database from being usable as a set of sessions.
+func HashRefreshToken(token string) string {
+	return HashOpaqueToken(token)
+}
+
+// HashOpaqueToken is the digest an opaque token is stored under.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
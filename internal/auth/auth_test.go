@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -31,4 +32,144 @@ func TestValidateJWT_ValidToken(t *testing.T) {
 	if returnedUUID != userID {
 		t.Errorf("expected UUID %v, got %v", userID, returnedUUID)
 	}
-}
\ No newline at end of file
+}
+
+func TestMakeJWT_CarriesRole(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	userID := uuid.New()
+	tokenString, err := MakeJWT(userID, RoleModerator, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Role != RoleModerator {
+		t.Errorf("expected role %q, got %q", RoleModerator, claims.Role)
+	}
+	if !claims.HasRole(RoleModerator, RoleAdmin) || claims.HasRole(RoleAdmin) {
+		t.Errorf("HasRole gave the wrong answer for role %q", claims.Role)
+	}
+}
+
+func TestParseJWT_DefaultsToUserRole(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	userID := uuid.New()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Subject:   userID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	tokenString, err := token.SignedString([]byte(tokenSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Role != RoleUser {
+		t.Errorf("expected role %q, got %q", RoleUser, claims.Role)
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("failed to make refresh token: %v", err)
+	}
+	hash := HashRefreshToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Errorf("expected a hex SHA-256 digest, got %q", hash)
+	}
+	if HashRefreshToken(token) != hash {
+		t.Errorf("hashing is not deterministic")
+	}
+}
+
+func TestValidator(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	keys := NewHMACKeyManager(tokenSecret)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	sign := func(method jwt.SigningMethod, key interface{}, mutate func(*Claims)) string {
+		t.Helper()
+		claims := Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			Audience:  jwt.ClaimStrings{"chirpy-api"},
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}}
+		if mutate != nil {
+			mutate(&claims)
+		}
+		tokenString, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return tokenString
+	}
+	hs256 := func(mutate func(*Claims)) string {
+		return sign(jwt.SigningMethodHS256, []byte(tokenSecret), mutate)
+	}
+	validator := &Validator{
+		Keys:       keys,
+		Issuer:     DefaultIssuer,
+		Audiences:  []string{"chirpy-api", "other-api"},
+		Algorithms: []string{"HS256"},
+		Leeway:     30 * time.Second,
+		Now:        func() time.Time { return now },
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", hs256(nil), nil},
+		{"expired", hs256(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }), ErrTokenExpired},
+		{"expired within leeway", hs256(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) }), nil},
+		{"missing expiry", hs256(func(c *Claims) { c.ExpiresAt = nil }), ErrTokenMalformed},
+		{"not before in the future", hs256(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }), ErrTokenNotYetValid},
+		{"not before within leeway", hs256(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) }), nil},
+		{"issued in the future", hs256(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }), ErrTokenNotYetValid},
+		{"wrong issuer", hs256(func(c *Claims) { c.Issuer = "someone-else" }), ErrTokenIssuer},
+		{"wrong audience", hs256(func(c *Claims) { c.Audience = jwt.ClaimStrings{"billing"} }), ErrTokenAudience},
+		{"missing audience", hs256(func(c *Claims) { c.Audience = nil }), ErrTokenAudience},
+		{"second audience", hs256(func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api"} }), nil},
+		{"bad subject", hs256(func(c *Claims) { c.Subject = "not-a-uuid" }), ErrTokenSubject},
+		{"wrong secret", sign(jwt.SigningMethodHS256, []byte("guessed"), nil), ErrTokenSignatureInvalid},
+		{"algorithm not allowed", sign(jwt.SigningMethodHS512, []byte(tokenSecret), nil), ErrTokenAlgorithm},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, nil), ErrTokenAlgorithm},
+		{"malformed", "not.a.jwt", ErrTokenMalformed},
+	}
+	for _, tc := range cases {
+		claims, err := validator.Validate(tc.token)
+		if tc.want == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			} else if got, _ := claims.UserID(); got != userID {
+				t.Errorf("%s: expected user %v, got %v", tc.name, userID, got)
+			}
+			continue
+		}
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestValidator_UnknownKey(t *testing.T) {
+	keys := NewHMACKeyManager("supersecretkey")
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(DefaultIssuer, nil, uuid.New(), RoleUser, time.Hour))
+	token.Header["kid"] = "missing"
+	tokenString, err := token.SignedString([]byte("supersecretkey"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if _, err := NewValidator(keys).Validate(tokenString); !errors.Is(err, ErrTokenUnverifiable) {
+		t.Errorf("expected ErrTokenUnverifiable, got %v", err)
+	}
+}
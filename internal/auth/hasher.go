@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms a PasswordHasher can produce.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	// ErrNoPassword is returned for accounts whose stored hash is the
+	// 'unset' placeholder users created before passwords existed were given.
+	ErrNoPassword        = errors.New("no password set")
+	ErrPasswordMismatch  = errors.New("password does not match")
+	ErrUnknownHashFormat = errors.New("unrecognised password hash format")
+	// ErrHasherBusy is returned when MaxConcurrent hashes are already
+	// running and none finished within MaxWait.
+	ErrHasherBusy = errors.New("too many passwords being hashed")
+)
+
+// unsetPasswordHash is the column default from migration 003.
+const unsetPasswordHash = "unset"
+
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHasher hashes new passwords with Algorithm and verifies hashes made
+// by any supported algorithm. Hashes are self-describing strings in PHC
+// format, such as "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>", or the
+// equivalent modular crypt format for bcrypt, so changing the algorithm or
+// its parameters never breaks existing hashes; they are upgraded as users
+// log in.
+//
+// Every hash holds Argon2.Memory KiB and a CPU until it is done, so at most
+// MaxConcurrent run at once; a caller that cannot start one within MaxWait
+// gets ErrHasherBusy instead of piling up more work. Zero MaxConcurrent
+// means no limit.
+type PasswordHasher struct {
+	Algorithm     string
+	Argon2        Argon2Params
+	BcryptCost    int
+	MaxConcurrent int
+	MaxWait       time.Duration
+
+	slotsOnce sync.Once
+	slots     chan struct{}
+
+	dummyMu   sync.Mutex
+	dummyHash string
+}
+
+// DefaultPasswordHasher uses Argon2id with the OWASP recommended minimum of
+// 19 MiB of memory, two passes and one thread, running one hash per CPU.
+func DefaultPasswordHasher() *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm: AlgorithmArgon2id,
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Time:        2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		BcryptCost:    bcrypt.DefaultCost,
+		MaxConcurrent: runtime.NumCPU(),
+		MaxWait:       time.Second,
+	}
+}
+
+// acquire takes one of the MaxConcurrent hashing slots. The returned func
+// gives it back.
+func (h *PasswordHasher) acquire() (func(), error) {
+	h.slotsOnce.Do(func() {
+		if h.MaxConcurrent > 0 {
+			h.slots = make(chan struct{}, h.MaxConcurrent)
+		}
+	})
+	if h.slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-h.slots }
+	select {
+	case h.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	timer := time.NewTimer(h.MaxWait)
+	defer timer.Stop()
+	select {
+	case h.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrHasherBusy
+	}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	release, err := h.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		p := h.Argon2
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Parallelism, p.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Time, p.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case AlgorithmBcrypt:
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %q", h.Algorithm)
+	}
+}
+
+// Verify checks password against hash. When it matches, needsRehash reports
+// whether hash should be replaced with a fresh one from Hash because it uses
+// another algorithm or weaker parameters.
+func (h *PasswordHasher) Verify(hash, password string) (needsRehash bool, err error) {
+	if hash == unsetPasswordHash || hash == "" {
+		return false, ErrNoPassword
+	}
+	release, err := h.acquire()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, ErrPasswordMismatch
+		}
+		return h.Algorithm != AlgorithmArgon2id ||
+			params.Memory < h.Argon2.Memory ||
+			params.Time < h.Argon2.Time ||
+			params.Parallelism < h.Argon2.Parallelism ||
+			uint32(len(salt)) < h.Argon2.SaltLength ||
+			uint32(len(key)) < h.Argon2.KeyLength, nil
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrPasswordMismatch
+		}
+		if err != nil {
+			return false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, err
+		}
+		return h.Algorithm != AlgorithmBcrypt || cost < h.BcryptCost, nil
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
+
+// VerifyDummy checks password against a hash of a random password made with
+// the current settings and returns ErrPasswordMismatch. Checking it when
+// there is no account to log in to takes as long as a wrong password for an
+// account that exists, so response times do not reveal which accounts do.
+func (h *PasswordHasher) VerifyDummy(password string) error {
+	h.dummyMu.Lock()
+	hash := h.dummyHash
+	h.dummyMu.Unlock()
+	if hash == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		var err error
+		hash, err = h.Hash(base64.RawStdEncoding.EncodeToString(random))
+		if err != nil {
+			return err
+		}
+		h.dummyMu.Lock()
+		h.dummyHash = hash
+		h.dummyMu.Unlock()
+	}
+	if _, err := h.Verify(hash, password); err != nil {
+		return err
+	}
+	return ErrPasswordMismatch
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	var params Argon2Params
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism)
+	if err != nil || params.Memory == 0 || params.Time == 0 || params.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
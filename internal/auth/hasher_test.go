@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHasher keeps Argon2id cheap so the tests stay fast.
+func testHasher() *PasswordHasher {
+	h := DefaultPasswordHasher()
+	h.Argon2.Memory = 64
+	h.Argon2.Time = 1
+	h.BcryptCost = bcrypt.MinCost
+	return h
+}
+
+func TestPasswordHasher_Argon2id(t *testing.T) {
+	h := testHasher()
+	hash, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected hash format %s", hash)
+	}
+	needsRehash, err := h.Verify(hash, "correct horse battery staple")
+	if err != nil || needsRehash {
+		t.Errorf("expected a current match, got rehash=%v err=%v", needsRehash, err)
+	}
+	if _, err := h.Verify(hash, "wrong"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected ErrPasswordMismatch, got %v", err)
+	}
+
+	h.Argon2.Time = 2
+	needsRehash, err = h.Verify(hash, "correct horse battery staple")
+	if err != nil || !needsRehash {
+		t.Errorf("hash with fewer passes should need a rehash, got rehash=%v err=%v", needsRehash, err)
+	}
+}
+
+func TestPasswordHasher_UpgradesBcrypt(t *testing.T) {
+	legacy := testHasher()
+	legacy.Algorithm = AlgorithmBcrypt
+	hash, err := legacy.Hash("hunter2hunter2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if needsRehash, err := legacy.Verify(hash, "hunter2hunter2"); err != nil || needsRehash {
+		t.Errorf("bcrypt hash at the configured cost should not need a rehash, got rehash=%v err=%v", needsRehash, err)
+	}
+	legacy.BcryptCost = bcrypt.MinCost + 1
+	if needsRehash, _ := legacy.Verify(hash, "hunter2hunter2"); !needsRehash {
+		t.Errorf("bcrypt hash below the configured cost should need a rehash")
+	}
+	if needsRehash, _ := testHasher().Verify(hash, "hunter2hunter2"); !needsRehash {
+		t.Errorf("bcrypt hash should need a rehash when Argon2id is configured")
+	}
+	if _, err := testHasher().Verify(hash, "wrong"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected ErrPasswordMismatch, got %v", err)
+	}
+}
+
+func TestPasswordHasher_VerifyDummy(t *testing.T) {
+	h := testHasher()
+	for i := 0; i < 2; i++ {
+		if err := h.VerifyDummy("correct horse battery staple"); !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("expected ErrPasswordMismatch, got %v", err)
+		}
+	}
+	if !strings.HasPrefix(h.dummyHash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("dummy hash should use the configured parameters, got %s", h.dummyHash)
+	}
+}
+
+func TestPasswordHasher_Unusable(t *testing.T) {
+	h := testHasher()
+	cases := []struct {
+		hash string
+		want error
+	}{
+		{"unset", ErrNoPassword},
+		{"", ErrNoPassword},
+		{"plaintext", ErrUnknownHashFormat},
+		{"$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5", ErrUnknownHashFormat},
+	}
+	for _, tc := range cases {
+		if _, err := h.Verify(tc.hash, "unset"); !errors.Is(err, tc.want) {
+			t.Errorf("%q: expected %v, got %v", tc.hash, tc.want, err)
+		}
+	}
+}
+
+func TestPasswordHasher_Busy(t *testing.T) {
+	h := testHasher()
+	h.MaxConcurrent = 1
+	h.MaxWait = 10 * time.Millisecond
+	release, err := h.acquire()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := h.Hash("correct horse battery staple"); !errors.Is(err, ErrHasherBusy) {
+		t.Errorf("expected ErrHasherBusy while the only slot is taken, got %v", err)
+	}
+	release()
+	hash, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("expected the freed slot to be used, got %v", err)
+	}
+	if _, err := h.Verify(hash, "correct horse battery staple"); err != nil {
+		t.Errorf("slots should be given back after each hash, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const minRSAKeyBits = 2048
+
+var ErrUnknownKey = errors.New("token was not signed by a known key")
+
+// SigningKey is one asymmetric key identified by its kid. Keys loaded from a
+// public key only can verify tokens but not sign them.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Retired bool
+
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+// ParseKeyPEM reads an RSA or Ed25519 key from PEM. Private keys may be PKCS#1
+// or PKCS#8; public keys must be PKIX.
+func ParseKeyPEM(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found", kid)
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", kid, err)
+	}
+	key := &SigningKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", kid, parsed)
+	}
+	if pub, ok := key.public.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("key %s: RSA keys must be at least %d bits", kid, minRSAKeyBits)
+	}
+	return key, nil
+}
+
+// KeyManager signs access tokens with its active key and verifies them with
+// any key that has not been retired. Rotating means adding a new key, making
+// it active once other services have picked it up from the JWKS, and retiring
+// the old one after the tokens it signed have expired.
+//
+// A legacy HMAC secret can be kept so that tokens issued before the switch to
+// asymmetric keys stay valid. It is only used for signing when there is no
+// active key.
+type KeyManager struct {
+	// Issuer and Audience are put in the tokens the manager signs.
+	Issuer   string
+	Audience []string
+
+	active       *SigningKey
+	keys         map[string]*SigningKey
+	legacySecret []byte
+}
+
+func NewKeyManager(activeKID string, legacySecret string, keys ...*SigningKey) (*KeyManager, error) {
+	km := &KeyManager{Issuer: DefaultIssuer, keys: make(map[string]*SigningKey, len(keys))}
+	if legacySecret != "" {
+		km.legacySecret = []byte(legacySecret)
+	}
+	for _, key := range keys {
+		if _, ok := km.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		km.keys[key.ID] = key
+	}
+	if activeKID != "" {
+		active, ok := km.keys[activeKID]
+		if !ok {
+			return nil, fmt.Errorf("active key %q not found", activeKID)
+		}
+		if active.Retired || !active.CanSign() {
+			return nil, fmt.Errorf("active key %q must be an unretired private key", activeKID)
+		}
+		km.active = active
+	}
+	if km.active == nil && km.legacySecret == nil {
+		return nil, errors.New("no key to sign tokens with")
+	}
+	return km, nil
+}
+
+// NewHMACKeyManager signs and verifies with a single shared secret, which is
+// how tokens were handled before asymmetric keys.
+func NewHMACKeyManager(secret string) *KeyManager {
+	return &KeyManager{Issuer: DefaultIssuer, keys: map[string]*SigningKey{}, legacySecret: []byte(secret)}
+}
+
+// LoadKeyManager reads every <kid>.pem file in dir. Keys named in retired are
+// loaded but no longer accepted.
+func LoadKeyManager(dir, activeKID string, retired []string, legacySecret string) (*KeyManager, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	isRetired := make(map[string]bool, len(retired))
+	for _, kid := range retired {
+		isRetired[kid] = true
+	}
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKeyPEM(kid, data)
+		if err != nil {
+			return nil, err
+		}
+		key.Retired = isRetired[kid]
+		keys = append(keys, key)
+	}
+	return NewKeyManager(activeKID, legacySecret, keys...)
+}
+
+func (km *KeyManager) MakeJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	token, _, err := km.IssueJWT(userID, role, expiresIn)
+	return token, err
+}
+
+// IssueJWT is MakeJWT that also returns the signed claims, whose ID is what
+// RevocationStore.RevokeToken needs to revoke the token early.
+func (km *KeyManager) IssueJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, Claims, error) {
+	claims := newClaims(km.Issuer, km.Audience, userID, role, expiresIn)
+	token, err := km.Sign(claims)
+	return token, claims, err
+}
+
+// Sign signs claims with the active key, naming it in the kid header.
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	if km.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(km.legacySecret)
+	}
+	token := jwt.NewWithClaims(km.active.Method, claims)
+	token.Header["kid"] = km.active.ID
+	return token.SignedString(km.active.private)
+}
+
+// ParseJWT validates tokenString with the default Validator for km.
+func (km *KeyManager) ParseJWT(tokenString string) (*Claims, error) {
+	return NewValidator(km).Validate(tokenString)
+}
+
+// Keyfunc picks the verification key for token by its kid header. Tokens
+// without a kid can only be legacy HMAC tokens.
+func (km *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if km.legacySecret == nil || token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, ErrUnknownKey
+		}
+		return km.legacySecret, nil
+	}
+	key, ok := km.keys[kid]
+	if !ok || key.Retired || key.Method.Alg() != token.Method.Alg() {
+		return nil, ErrUnknownKey
+	}
+	return key.public, nil
+}
+
+// Algorithms lists the signing algorithms of the keys that are accepted.
+func (km *KeyManager) Algorithms() []string {
+	seen := map[string]bool{}
+	if km.legacySecret != nil {
+		seen[jwt.SigningMethodHS256.Alg()] = true
+	}
+	for _, key := range km.keys {
+		if !key.Retired {
+			seen[key.Method.Alg()] = true
+		}
+	}
+	algs := make([]string, 0, len(seen))
+	for alg := range seen {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of the keys that are accepted, so that other
+// services can verify tokens without sharing a secret.
+func (km *KeyManager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range km.keys {
+		if key.Retired {
+			continue
+		}
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
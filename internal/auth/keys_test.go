@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func rsaKeyPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func ed25519KeyPEM(t *testing.T) []byte {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func mustParseKey(t *testing.T, kid string, data []byte) *SigningKey {
+	t.Helper()
+	key, err := ParseKeyPEM(kid, data)
+	if err != nil {
+		t.Fatalf("failed to parse key %s: %v", kid, err)
+	}
+	return key
+}
+
+func TestKeyManager_SignAndVerify(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pem  []byte
+		alg  string
+	}{
+		{"rsa", rsaKeyPEM(t), "RS256"},
+		{"ed25519", ed25519KeyPEM(t), "EdDSA"},
+	} {
+		km, err := NewKeyManager("k1", "", mustParseKey(t, "k1", tc.pem))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		userID := uuid.New()
+		tokenString, err := km.MakeJWT(userID, RoleAdmin, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: failed to make token: %v", tc.name, err)
+		}
+		token, _, err := jwt.NewParser().ParseUnverified(tokenString, &Claims{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if token.Method.Alg() != tc.alg || token.Header["kid"] != "k1" {
+			t.Errorf("%s: expected alg %s and kid k1, got %s and %v", tc.name, tc.alg, token.Method.Alg(), token.Header["kid"])
+		}
+		claims, err := km.ParseJWT(tokenString)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got, _ := claims.UserID(); got != userID || claims.Role != RoleAdmin {
+			t.Errorf("%s: claims did not round trip: %+v", tc.name, claims)
+		}
+	}
+}
+
+func TestKeyManager_Rotation(t *testing.T) {
+	oldKey, newKey := rsaKeyPEM(t), ed25519KeyPEM(t)
+	before, err := NewKeyManager("old", "", mustParseKey(t, "old", oldKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	oldToken, err := before.MakeJWT(uuid.New(), RoleUser, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+
+	during, err := NewKeyManager("new", "", mustParseKey(t, "old", oldKey), mustParseKey(t, "new", newKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := during.ParseJWT(oldToken); err != nil {
+		t.Errorf("token signed by the previous key should still verify: %v", err)
+	}
+
+	retired := mustParseKey(t, "old", oldKey)
+	retired.Retired = true
+	after, err := NewKeyManager("new", "", retired, mustParseKey(t, "new", newKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := after.ParseJWT(oldToken); err == nil {
+		t.Errorf("token signed by a retired key should be rejected")
+	}
+	if jwks := after.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "new" {
+		t.Errorf("retired keys should not be published: %+v", jwks)
+	}
+}
+
+func TestKeyManager_LegacySecret(t *testing.T) {
+	legacyToken, err := MakeJWT(uuid.New(), RoleUser, "supersecretkey", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	withLegacy, err := NewKeyManager("k1", "supersecretkey", mustParseKey(t, "k1", ed25519KeyPEM(t)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := withLegacy.ParseJWT(legacyToken); err != nil {
+		t.Errorf("legacy HS256 token should verify: %v", err)
+	}
+	withoutLegacy, err := NewKeyManager("k1", "", mustParseKey(t, "k1", ed25519KeyPEM(t)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := withoutLegacy.ParseJWT(legacyToken); err == nil {
+		t.Errorf("HS256 token should be rejected without a legacy secret")
+	}
+}
+
+func TestKeyManager_RejectsAlgorithmMismatch(t *testing.T) {
+	km, err := NewKeyManager("k1", "", mustParseKey(t, "k1", ed25519KeyPEM(t)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(DefaultIssuer, nil, uuid.New(), RoleAdmin, time.Hour))
+	token.Header["kid"] = "k1"
+	tokenString, err := token.SignedString([]byte("guessed"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if _, err := km.ParseJWT(tokenString); err == nil {
+		t.Errorf("HS256 token naming an EdDSA key should be rejected")
+	}
+}
+
+func TestLoadKeyManager(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2024-01.pem"), rsaKeyPEM(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2024-06.pem"), ed25519KeyPEM(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	km, err := LoadKeyManager(dir, "2024-06", nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jwks := km.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %d", len(jwks.Keys))
+	}
+	if k := jwks.Keys[0]; k.KeyID != "2024-01" || k.KeyType != "RSA" || k.N == "" || k.E != "AQAB" {
+		t.Errorf("unexpected RSA JWK: %+v", k)
+	}
+	if k := jwks.Keys[1]; k.KeyID != "2024-06" || k.KeyType != "OKP" || k.Curve != "Ed25519" || k.X == "" {
+		t.Errorf("unexpected Ed25519 JWK: %+v", k)
+	}
+	if _, err := LoadKeyManager(dir, "2024-06", []string{"2024-06"}, ""); err == nil {
+		t.Errorf("a retired key should not be usable as the active key")
+	}
+}
@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request. Callers using an API
+// key have its ID in APIKeyID and are limited to its Scopes; TokenID is only
+// set for access tokens.
+type Principal struct {
+	UserID   uuid.UUID
+	Roles    []string
+	TokenID  string
+	APIKeyID uuid.UUID
+	Scopes   []string
+}
+
+func (p Principal) HasRole(roles ...string) bool {
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the caller may act with scope. Access tokens are
+// not limited to any scopes.
+func (p Principal) HasScope(scope string) bool {
+	if p.APIKeyID == uuid.Nil {
+		return true
+	}
+	for _, have := range p.Scopes {
+		if have == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the caller stored by Middleware. ok is false
+// for anonymous requests.
+func PrincipalFromContext(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// Middleware validates access tokens once per request and stores the caller
+// in the request context. Failures are answered with the challenges described
+// in RFC 6750 section 3.
+type Middleware struct {
+	validator   *Validator
+	realm       string
+	revocations RevocationStore
+	apiKeys     APIKeyStore
+}
+
+// NewMiddleware returns a Middleware that checks tokens against revocations,
+// which may be nil to accept every well-formed token until it expires.
+func NewMiddleware(validator *Validator, revocations RevocationStore) *Middleware {
+	return &Middleware{validator: validator, realm: "chirpy", revocations: revocations}
+}
+
+// AcceptAPIKeys lets routes wrapped with RequireScope or OptionalScope be
+// called with API keys found in keys.
+func (m *Middleware) AcceptAPIKeys(keys APIKeyStore) *Middleware {
+	m.apiKeys = keys
+	return m
+}
+
+// RequireAuth rejects requests without a valid access token. API keys are
+// refused, since the route has not said which scope they would need.
+func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
+	return m.RequireScope(next, "")
+}
+
+// RequireScope rejects requests without a valid access token, or an API key
+// with scope.
+func (m *Middleware) RequireScope(next http.Handler, scope string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := m.authenticate(r, scope)
+		if err != nil {
+			m.fail(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through. A request whose credentials
+// are no longer good, such as an expired or revoked access token, is served
+// as anonymous too, so public pages keep working for a client that has not
+// refreshed yet; only a malformed Authorization header is rejected. API keys
+// are refused.
+func (m *Middleware) OptionalAuth(next http.Handler) http.Handler {
+	return m.OptionalScope(next, "")
+}
+
+// OptionalScope is OptionalAuth that also accepts API keys with scope.
+func (m *Middleware) OptionalScope(next http.Handler, scope string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := m.authenticate(r, scope)
+		if err != nil && servableAnonymously(err) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			m.fail(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+// RequireRole is RequireAuth that also insists the caller has one of roles.
+func (m *Middleware) RequireRole(next http.Handler, roles ...string) http.Handler {
+	return m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		if !p.HasRole(roles...) {
+			m.challenge(w, http.StatusForbidden, "insufficient_scope", "You do not have permission to do that")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// authenticate identifies the caller. scope is what an API key needs to be
+// accepted; API keys are refused when it is empty.
+func (m *Middleware) authenticate(r *http.Request, scope string) (Principal, error) {
+	scheme, credentials, err := GetAuthorization(r.Header)
+	if err != nil {
+		return Principal{}, err
+	}
+	switch {
+	case scheme == SchemeBearer:
+		return m.authenticateToken(r, credentials)
+	case scheme == SchemeAPIKey && m.apiKeys != nil:
+		return m.authenticateAPIKey(r, credentials, scope)
+	default:
+		return Principal{}, ErrNotBearer
+	}
+}
+
+func (m *Middleware) authenticateToken(r *http.Request, tokenString string) (Principal, error) {
+	claims, err := m.validator.Validate(tokenString)
+	if err != nil {
+		return Principal{}, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return Principal{}, err
+	}
+	if m.revocations != nil {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		revoked, err := m.revocations.IsRevoked(r.Context(), claims.ID, userID, issuedAt)
+		if err != nil {
+			return Principal{}, fmt.Errorf("%w: %v", errRevocationCheck, err)
+		}
+		if revoked {
+			return Principal{}, ErrTokenRevoked
+		}
+	}
+	return Principal{
+		UserID:  userID,
+		Roles:   []string{claims.Role},
+		TokenID: claims.ID,
+	}, nil
+}
+
+func (m *Middleware) authenticateAPIKey(r *http.Request, key, scope string) (Principal, error) {
+	apiKey, err := m.apiKeys.LookupAPIKey(r.Context(), HashOpaqueToken(key))
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyInvalid) {
+			return Principal{}, err
+		}
+		return Principal{}, fmt.Errorf("%w: %v", errAPIKeyCheck, err)
+	}
+	if !apiKey.ExpiresAt.IsZero() && !time.Now().Before(apiKey.ExpiresAt) {
+		return Principal{}, ErrAPIKeyInvalid
+	}
+	p := Principal{
+		UserID:   apiKey.UserID,
+		Roles:    []string{apiKey.Role},
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}
+	if scope == "" {
+		return Principal{}, errAPIKeyNotAllowed
+	}
+	if !p.HasScope(scope) {
+		return Principal{}, fmt.Errorf("%w: %s", errAPIKeyScope, scope)
+	}
+	m.apiKeys.RecordAPIKeyUse(r.Context(), apiKey.ID)
+	return p, nil
+}
+
+var (
+	ErrTokenRevoked     = errors.New("access token has been revoked")
+	errRevocationCheck  = errors.New("checking access token revocation")
+	errAPIKeyCheck      = errors.New("checking api key")
+	errAPIKeyNotAllowed = errors.New("api keys cannot be used for this request")
+	errAPIKeyScope      = errors.New("api key is missing scope")
+)
+
+// servableAnonymously reports whether OptionalScope may serve a request that
+// failed authentication with err as if it had no credentials. Malformed
+// headers, API keys used where they are not allowed and failures on our side
+// are still answered with an error.
+func servableAnonymously(err error) bool {
+	switch {
+	case errors.Is(err, ErrMalformedAuthHeader),
+		errors.Is(err, errAPIKeyNotAllowed),
+		errors.Is(err, errAPIKeyScope),
+		errors.Is(err, errRevocationCheck),
+		errors.Is(err, errAPIKeyCheck):
+		return false
+	default:
+		return true
+	}
+}
+
+// fail maps an authentication error to a response without exposing the
+// underlying library error to the client.
+func (m *Middleware) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNoAuthHeader), errors.Is(err, ErrNotBearer):
+		m.challenge(w, http.StatusUnauthorized, "", "Authentication required")
+	case errors.Is(err, ErrMalformedAuthHeader):
+		m.challenge(w, http.StatusBadRequest, "invalid_request", "Malformed authorization header")
+	case errors.Is(err, ErrTokenExpired):
+		m.challenge(w, http.StatusUnauthorized, "invalid_token", "The access token expired")
+	case errors.Is(err, ErrTokenRevoked):
+		m.challenge(w, http.StatusUnauthorized, "invalid_token", "The access token has been revoked")
+	case errors.Is(err, ErrAPIKeyInvalid):
+		m.challenge(w, http.StatusUnauthorized, "invalid_token", "The API key is invalid, expired or revoked")
+	case errors.Is(err, errAPIKeyNotAllowed):
+		m.challenge(w, http.StatusForbidden, "insufficient_scope", "API keys cannot be used for this request")
+	case errors.Is(err, errAPIKeyScope):
+		m.challenge(w, http.StatusForbidden, "insufficient_scope", "The API key does not have the scope needed for this request")
+	case errors.Is(err, errRevocationCheck), errors.Is(err, errAPIKeyCheck):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{Error: "Error when attempting to authenticate request"})
+	default:
+		m.challenge(w, http.StatusUnauthorized, "invalid_token", "The access token is invalid")
+	}
+}
+
+func (m *Middleware) challenge(w http.ResponseWriter, code int, errCode, description string) {
+	challenge := fmt.Sprintf(`Bearer realm=%q`, m.realm)
+	if errCode != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, errCode, description)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: description})
+}
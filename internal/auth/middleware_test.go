@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func serveWith(h http.Handler, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequireAuth_InjectsPrincipal(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	userID := uuid.New()
+	tokenString, err := MakeJWT(userID, RoleModerator, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	var got Principal
+	h := NewMiddleware(NewValidator(NewHMACKeyManager(tokenSecret)), nil).RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+	rec := serveWith(h, "Bearer "+tokenString)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got.UserID != userID {
+		t.Errorf("expected user %v, got %v", userID, got.UserID)
+	}
+	if !got.HasRole(RoleModerator) {
+		t.Errorf("expected role %q, got %v", RoleModerator, got.Roles)
+	}
+	if got.TokenID == "" {
+		t.Errorf("expected a token ID")
+	}
+}
+
+func TestRequireAuth_Challenges(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	expired, err := MakeJWT(uuid.New(), RoleUser, tokenSecret, -time.Minute)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	cases := []struct {
+		name          string
+		authorization string
+		code          int
+		challenge     string
+	}{
+		{"missing", "", http.StatusUnauthorized, `Bearer realm="chirpy"`},
+		{"other scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, `Bearer realm="chirpy"`},
+		{"malformed", "Bearer", http.StatusBadRequest, `error="invalid_request"`},
+		{"garbage", "Bearer not-a-token", http.StatusUnauthorized, `error="invalid_token"`},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized, `error_description="The access token expired"`},
+	}
+	h := NewMiddleware(NewValidator(NewHMACKeyManager(tokenSecret)), nil).RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("handler should not have been called")
+	}))
+	for _, tc := range cases {
+		rec := serveWith(h, tc.authorization)
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.code, rec.Code)
+		}
+		if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tc.challenge) {
+			t.Errorf("%s: expected challenge containing %s, got %s", tc.name, tc.challenge, challenge)
+		}
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	called := false
+	authenticated := false
+	h := NewMiddleware(NewValidator(NewHMACKeyManager(tokenSecret)), nil).OptionalAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		_, authenticated = PrincipalFromContext(r.Context())
+	}))
+	rec := serveWith(h, "")
+	if rec.Code != http.StatusOK || !called || authenticated {
+		t.Errorf("anonymous request should reach the handler without a principal")
+	}
+	expired, err := MakeJWT(uuid.New(), RoleUser, tokenSecret, -time.Minute)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	for _, authorization := range []string{"Bearer not-a-token", "Bearer " + expired} {
+		called, authenticated = false, false
+		rec = serveWith(h, authorization)
+		if rec.Code != http.StatusOK || !called || authenticated {
+			t.Errorf("%q should be served anonymously, got %d", authorization, rec.Code)
+		}
+	}
+	called = false
+	rec = serveWith(h, "Bearer")
+	if rec.Code != http.StatusBadRequest || called {
+		t.Errorf("malformed header should be rejected, got %d", rec.Code)
+	}
+}
+
+func TestRequireRole_InsufficientScope(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	tokenString, err := MakeJWT(uuid.New(), RoleUser, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	h := NewMiddleware(NewValidator(NewHMACKeyManager(tokenSecret)), nil).RequireRole(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("handler should not have been called")
+	}), RoleAdmin)
+	rec := serveWith(h, "Bearer "+tokenString)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="insufficient_scope"`) {
+		t.Errorf("expected insufficient_scope challenge, got %s", challenge)
+	}
+}
+
+type fakeAPIKeyStore struct {
+	keys map[string]APIKey
+	used map[uuid.UUID]int
+}
+
+func (f *fakeAPIKeyStore) LookupAPIKey(ctx context.Context, keyHash string) (APIKey, error) {
+	key, ok := f.keys[keyHash]
+	if !ok {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	return key, nil
+}
+
+func (f *fakeAPIKeyStore) RecordAPIKeyUse(ctx context.Context, keyID uuid.UUID) {
+	f.used[keyID]++
+}
+
+func TestAPIKeys(t *testing.T) {
+	reader, _ := MakeAPIKey()
+	expired, _ := MakeAPIKey()
+	keyID := uuid.New()
+	store := &fakeAPIKeyStore{
+		keys: map[string]APIKey{
+			HashOpaqueToken(reader):  {ID: keyID, UserID: uuid.New(), Role: RoleUser, Scopes: []string{ScopeChirpsRead}},
+			HashOpaqueToken(expired): {ID: uuid.New(), UserID: uuid.New(), Role: RoleUser, Scopes: []string{ScopeChirpsRead}, ExpiresAt: time.Now().Add(-time.Minute)},
+		},
+		used: make(map[uuid.UUID]int),
+	}
+	m := NewMiddleware(NewValidator(NewHMACKeyManager("supersecretkey")), nil).AcceptAPIKeys(store)
+	var got Principal
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	})
+
+	if rec := serveWith(m.RequireScope(ok, ScopeChirpsRead), "ApiKey "+reader); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got.APIKeyID != keyID || got.TokenID != "" {
+		t.Errorf("expected principal for key %v, got %+v", keyID, got)
+	}
+	if rec := serveWith(m.OptionalScope(ok, ScopeChirpsRead), "ApiKey "+reader); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 from OptionalScope, got %d", rec.Code)
+	}
+
+	if store.used[keyID] != 2 {
+		t.Errorf("expected 2 recorded uses, got %d", store.used[keyID])
+	}
+
+	cases := []struct {
+		name          string
+		handler       http.Handler
+		authorization string
+		code          int
+	}{
+		{"missing scope", m.RequireScope(ok, ScopeChirpsWrite), "ApiKey " + reader, http.StatusForbidden},
+		{"route without scope", m.RequireAuth(ok), "ApiKey " + reader, http.StatusForbidden},
+		{"optional route without scope", m.OptionalAuth(ok), "ApiKey " + reader, http.StatusForbidden},
+		{"admin route", m.RequireRole(ok, RoleUser), "ApiKey " + reader, http.StatusForbidden},
+		{"expired", m.RequireScope(ok, ScopeChirpsRead), "ApiKey " + expired, http.StatusUnauthorized},
+		{"unknown", m.RequireScope(ok, ScopeChirpsRead), "ApiKey chirpy_nope", http.StatusUnauthorized},
+		{"key sent as bearer", m.RequireScope(ok, ScopeChirpsRead), "Bearer " + reader, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if rec := serveWith(tc.handler, tc.authorization); rec.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.code, rec.Code)
+		}
+	}
+	if store.used[keyID] != 2 {
+		t.Errorf("refused requests should not record a use, got %d uses", store.used[keyID])
+	}
+
+	if rec := serveWith(NewMiddleware(NewValidator(NewHMACKeyManager("supersecretkey")), nil).RequireScope(ok, ScopeChirpsRead), "ApiKey "+reader); rec.Code != http.StatusUnauthorized {
+		t.Errorf("API keys should be refused unless accepted, got %d", rec.Code)
+	}
+}
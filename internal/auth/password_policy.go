@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+func parseCommonPasswords(list string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
+
+// Rules reported in a PasswordViolation.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleCommon    = "common"
+	RuleBreached  = "breached"
+)
+
+// PasswordViolation is one rule a password failed.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// BreachChecker reports whether a password is known from a data breach.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// PasswordPolicy decides which passwords are acceptable for new accounts and
+// password changes. MinLength counts characters; MaxBytes exists because
+// bcrypt ignores everything after its 72nd byte, so longer passwords would
+// be accepted without all of them mattering. Breaches may be nil.
+type PasswordPolicy struct {
+	MinLength    int
+	MaxBytes     int
+	RejectCommon bool
+	Breaches     BreachChecker
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: at least 8 characters and
+// none of the commonly used passwords, but no composition rules.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    8,
+		MaxBytes:     72,
+		RejectCommon: true,
+	}
+}
+
+// Check returns every rule password breaks, or none if it is acceptable.
+// An error means the breach corpus could not be consulted.
+func (p PasswordPolicy) Check(password string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes long", p.MaxBytes),
+		})
+	}
+	if p.RejectCommon && IsCommonPassword(password) {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleCommon,
+			Message: "Password is too common",
+		})
+	}
+	if p.Breaches != nil && password != "" {
+		breached, err := p.Breaches.IsBreached(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Rule:    RuleBreached,
+				Message: "Password has appeared in a data breach",
+			})
+		}
+	}
+	return violations, nil
+}
+
+// IsCommonPassword reports whether password is on the bundled list of
+// frequently used passwords, ignoring case.
+func IsCommonPassword(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+// BreachCorpus checks passwords against a local copy of a k-anonymity SHA-1
+// range corpus, laid out like the Pwned Passwords downloader leaves it: one
+// file per five hex digit prefix, named e.g. 21BD1.txt, holding lines of
+// "<remaining 35 hex digits>:<count>". A missing prefix file means no
+// password with that prefix is known.
+type BreachCorpus struct {
+	Dir string
+	// MinCount ignores hashes seen fewer times than this in breaches.
+	MinCount int
+}
+
+func NewBreachCorpus(dir string) (*BreachCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachCorpus{Dir: dir, MinCount: 1}, nil
+}
+
+func (c *BreachCorpus) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.Dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hashSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(hashSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, fmt.Errorf("%s.txt: bad count %q", prefix, count)
+		}
+		return n >= c.MinCount, nil
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	cases := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"acceptable", "correct horse battery staple", nil},
+		{"empty", "", []string{RuleMinLength}},
+		{"short", "x7#kq", []string{RuleMinLength}},
+		{"common", "Password123", []string{RuleCommon}},
+		{"short and common", "abc123", []string{RuleMinLength, RuleCommon}},
+		{"too many bytes", strings.Repeat("é", 40), []string{RuleMaxLength}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := policy.Check(tc.password)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Rule)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("expected violations %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBreachCorpus(t *testing.T) {
+	dir := t.TempDir()
+	breached := "Tr0ub4dor&3-leaked"
+	sum := sha1.Sum([]byte(breached))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	data := "0000000000000000000000000000000000A:3\r\n" + strings.ToLower(hash[5:]) + ":42\r\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(data), 0o644); err != nil {
+		t.Fatalf("failed to write corpus: %v", err)
+	}
+	corpus, err := NewBreachCorpus(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	policy := DefaultPasswordPolicy()
+	policy.Breaches = corpus
+	violations, err := policy.Check(breached)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Rule != RuleBreached {
+		t.Errorf("expected a breached violation, got %v", violations)
+	}
+	if ok, _ := corpus.IsBreached("a password nobody has used"); ok {
+		t.Errorf("password without a prefix file should not be reported as breached")
+	}
+
+	corpus.MinCount = 100
+	if ok, _ := corpus.IsBreached(breached); ok {
+		t.Errorf("password seen fewer than MinCount times should be allowed")
+	}
+}
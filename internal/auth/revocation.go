@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationStore records access tokens that must stop working before they
+// expire, either one at a time by token ID or for every token issued to a
+// user before a cutoff. Token issue times are kept to the microsecond, so a
+// token issued in the same microsecond as the cutoff counts as issued before
+// it; cutoffs must not be rounded down themselves or such tokens survive.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, tokenID string, userID uuid.UUID, expiresAt time.Time) error
+	RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time) error
+	IsRevoked(ctx context.Context, tokenID string, userID uuid.UUID, issuedAt time.Time) (bool, error)
+}
+
+type cachedRevocation struct {
+	userID  uuid.UUID
+	revoked bool
+	until   time.Time
+}
+
+// CachedRevocationStore remembers IsRevoked answers for a while so that
+// authenticating a request does not normally need a database round trip.
+// Revocations made through it take effect immediately on this process; ones
+// made elsewhere are picked up once the cached answer expires.
+type CachedRevocationStore struct {
+	store RevocationStore
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedRevocation
+}
+
+func NewCachedRevocationStore(store RevocationStore, ttl time.Duration) *CachedRevocationStore {
+	return &CachedRevocationStore{
+		store:   store,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedRevocation),
+	}
+}
+
+func (c *CachedRevocationStore) RevokeToken(ctx context.Context, tokenID string, userID uuid.UUID, expiresAt time.Time) error {
+	if err := c.store.RevokeToken(ctx, tokenID, userID, expiresAt); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A revoked answer never goes stale, so keep it until the token expires.
+	c.entries[tokenID] = cachedRevocation{userID: userID, revoked: true, until: expiresAt}
+	return nil
+}
+
+func (c *CachedRevocationStore) RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	if err := c.store.RevokeUser(ctx, userID, before); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for tokenID, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, tokenID)
+		}
+	}
+	return nil
+}
+
+func (c *CachedRevocationStore) IsRevoked(ctx context.Context, tokenID string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[tokenID]
+	if ok && now.After(entry.until) {
+		delete(c.entries, tokenID)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return entry.revoked, nil
+	}
+
+	revoked, err := c.store.IsRevoked(ctx, tokenID, userID, issuedAt)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(now)
+	c.entries[tokenID] = cachedRevocation{userID: userID, revoked: revoked, until: now.Add(c.ttl)}
+	return revoked, nil
+}
+
+// pruneLocked drops expired entries once the cache has grown, so tokens that
+// are never seen again do not accumulate.
+func (c *CachedRevocationStore) pruneLocked(now time.Time) {
+	if len(c.entries) < 1024 {
+		return
+	}
+	for tokenID, entry := range c.entries {
+		if now.After(entry.until) {
+			delete(c.entries, tokenID)
+		}
+	}
+}
+
+// MemoryRevocationStore is a RevocationStore that lives only as long as the
+// process. It is useful in tests and single-instance development setups.
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	tokens  map[string]time.Time
+	cutoffs map[uuid.UUID]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:  make(map[string]time.Time),
+		cutoffs: make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (m *MemoryRevocationStore) RevokeToken(ctx context.Context, tokenID string, userID uuid.UUID, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (m *MemoryRevocationStore) RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if before.After(m.cutoffs[userID]) {
+		m.cutoffs[userID] = before
+	}
+	return nil
+}
+
+func (m *MemoryRevocationStore) IsRevoked(ctx context.Context, tokenID string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tokens[tokenID]; ok {
+		return true, nil
+	}
+	cutoff, ok := m.cutoffs[userID]
+	return ok && issuedAt.Before(cutoff), nil
+}
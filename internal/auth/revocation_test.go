@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type countingStore struct {
+	RevocationStore
+	checks int
+}
+
+func (c *countingStore) IsRevoked(ctx context.Context, tokenID string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	c.checks++
+	return c.RevocationStore.IsRevoked(ctx, tokenID, userID, issuedAt)
+}
+
+func TestMemoryRevocationStore_UserCutoff(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	userID := uuid.New()
+	cutoff := time.Unix(1700000000, 500000000)
+	if err := store.RevokeUser(ctx, userID, cutoff); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	revoked, _ := store.IsRevoked(ctx, "old", userID, cutoff.Add(-time.Second))
+	if !revoked {
+		t.Errorf("token issued before the cutoff should be revoked")
+	}
+	revoked, _ = store.IsRevoked(ctx, "same second", userID, cutoff.Truncate(time.Second))
+	if !revoked {
+		t.Errorf("token issued earlier in the cutoff's second should be revoked")
+	}
+	revoked, _ = store.IsRevoked(ctx, "new", userID, cutoff.Add(time.Microsecond))
+	if revoked {
+		t.Errorf("token issued later in the cutoff's second should still be valid")
+	}
+	revoked, _ = store.IsRevoked(ctx, "newer", userID, cutoff.Truncate(time.Second).Add(time.Second))
+	if revoked {
+		t.Errorf("token issued after the cutoff should still be valid")
+	}
+	revoked, _ = store.IsRevoked(ctx, "other", uuid.New(), cutoff.Add(-time.Second))
+	if revoked {
+		t.Errorf("cutoff should only apply to its own user")
+	}
+}
+
+func TestCachedRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingStore{RevocationStore: NewMemoryRevocationStore()}
+	cache := NewCachedRevocationStore(backing, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	userID := uuid.New()
+	issuedAt := now.Add(-time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if revoked, err := cache.IsRevoked(ctx, "jti", userID, issuedAt); err != nil || revoked {
+			t.Fatalf("expected valid token, got revoked=%v err=%v", revoked, err)
+		}
+	}
+	if backing.checks != 1 {
+		t.Errorf("expected 1 backing lookup, got %d", backing.checks)
+	}
+
+	if err := cache.RevokeUser(ctx, userID, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if revoked, _ := cache.IsRevoked(ctx, "jti", userID, issuedAt); !revoked {
+		t.Errorf("revoking the user should not be hidden by the cache")
+	}
+
+	if err := cache.RevokeToken(ctx, "other", uuid.New(), now.Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checks := backing.checks
+	if revoked, _ := cache.IsRevoked(ctx, "other", uuid.New(), now); !revoked {
+		t.Errorf("revoked token should be reported as revoked")
+	}
+	if backing.checks != checks {
+		t.Errorf("revoked token should be answered from the cache")
+	}
+}
+
+func TestRequireAuth_RejectsRevokedToken(t *testing.T) {
+	tokenSecret := "supersecretkey"
+	userID := uuid.New()
+	tokenString, err := MakeJWT(userID, RoleUser, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to make token: %v", err)
+	}
+	store := NewMemoryRevocationStore()
+	h := NewMiddleware(NewValidator(NewHMACKeyManager(tokenSecret)), store).RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if rec := serveWith(h, "Bearer "+tokenString); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 before revocation, got %d", rec.Code)
+	}
+	store.RevokeUser(context.Background(), userID, time.Now().Add(time.Second))
+	if rec := serveWith(h, "Bearer "+tokenString); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after revocation, got %d", rec.Code)
+	}
+}
+
+func TestRequireAuth_CutoffKeepsLaterTokensInSameSecond(t *testing.T) {
+	km := NewHMACKeyManager("supersecretkey")
+	store := NewMemoryRevocationStore()
+	h := NewMiddleware(NewValidator(km), store).RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Retry in the unlikely case that the two tokens straddle a second boundary.
+	for attempt := 0; attempt < 5; attempt++ {
+		userID := uuid.New()
+		before, beforeClaims, err := km.IssueJWT(userID, RoleUser, time.Hour)
+		if err != nil {
+			t.Fatalf("failed to make token: %v", err)
+		}
+		cutoff := beforeClaims.IssuedAt.Time.Add(time.Microsecond)
+		store.RevokeUser(context.Background(), userID, cutoff)
+		time.Sleep(time.Millisecond)
+		after, afterClaims, err := km.IssueJWT(userID, RoleUser, time.Hour)
+		if err != nil {
+			t.Fatalf("failed to make token: %v", err)
+		}
+		if afterClaims.IssuedAt.Unix() != cutoff.Unix() {
+			continue
+		}
+
+		if rec := serveWith(h, "Bearer "+before); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 for a token issued before the cutoff, got %d", rec.Code)
+		}
+		if rec := serveWith(h, "Bearer "+after); rec.Code != http.StatusOK {
+			t.Errorf("expected 200 for a token issued after the cutoff in the same second, got %d", rec.Code)
+		}
+		return
+	}
+	t.Fatal("could not issue two tokens within the same second")
+}
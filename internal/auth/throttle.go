@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginAttempts is the recent failure history of one key, such as an account
+// or a client IP address.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// LoginAttemptStore records failed logins per key. RecordFailure forgets
+// failures made before since, so an old streak does not count against a new
+// one, and returns the updated history. Get returns the zero value for keys
+// with no failures.
+type LoginAttemptStore interface {
+	RecordFailure(ctx context.Context, key string, at, since time.Time) (LoginAttempts, error)
+	Get(ctx context.Context, key string) (LoginAttempts, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// ThrottlePolicy turns a failure history into how long the next attempt has
+// to wait. The first FreeAttempts failures cost nothing, after that the delay
+// starts at BaseDelay and doubles with each failure up to MaxDelay, and
+// LockoutAfter failures lock the key out for LockoutDuration. Failures are
+// forgotten once none has happened for Window.
+type ThrottlePolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// Wait returns how long after now the next attempt must wait, or zero if it
+// may go ahead.
+func (p ThrottlePolicy) Wait(a LoginAttempts, now time.Time) time.Duration {
+	if a.Failures == 0 || now.Sub(a.LastFailure) > p.Window {
+		return 0
+	}
+	var delay time.Duration
+	switch {
+	case p.LockoutAfter > 0 && a.Failures >= p.LockoutAfter:
+		delay = p.LockoutDuration
+	case a.Failures > p.FreeAttempts:
+		delay = p.BaseDelay
+		for i := p.FreeAttempts + 1; i < a.Failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, p.MaxDelay)
+	}
+	return max(a.LastFailure.Add(delay).Sub(now), 0)
+}
+
+// LoginThrottle slows down password guessing by tracking failed logins both
+// per account, against guessing one user's password, and per client IP,
+// against one client trying many accounts. IP limits should be looser since
+// many users can share an address.
+//
+// Checks and failures are not atomic, so a burst of concurrent attempts can
+// each get through before the others are recorded; the store still counts
+// all of them.
+type LoginThrottle struct {
+	Store   LoginAttemptStore
+	Account ThrottlePolicy
+	IP      ThrottlePolicy
+	Now     func() time.Time
+}
+
+// NewLoginThrottle returns a LoginThrottle with the default policies: an
+// account is locked for 15 minutes after 10 failures and an IP address after
+// 50, with backoff starting after 3 and 10 failures respectively.
+func NewLoginThrottle(store LoginAttemptStore) *LoginThrottle {
+	return &LoginThrottle{
+		Store: store,
+		Account: ThrottlePolicy{
+			FreeAttempts:    3,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutAfter:    10,
+			LockoutDuration: 15 * time.Minute,
+			Window:          time.Hour,
+		},
+		IP: ThrottlePolicy{
+			FreeAttempts:    10,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutAfter:    50,
+			LockoutDuration: 15 * time.Minute,
+			Window:          time.Hour,
+		},
+		Now: time.Now,
+	}
+}
+
+// Check returns how long a login for account from ip has to wait. An empty
+// ip is not tracked.
+func (t *LoginThrottle) Check(ctx context.Context, account, ip string) (time.Duration, error) {
+	now := t.Now()
+	attempts, err := t.Store.Get(ctx, accountKey(account))
+	if err != nil {
+		return 0, err
+	}
+	wait := t.Account.Wait(attempts, now)
+	if ip != "" {
+		attempts, err = t.Store.Get(ctx, ipKey(ip))
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, t.IP.Wait(attempts, now))
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed login and returns how long the next attempt
+// will have to wait.
+func (t *LoginThrottle) RecordFailure(ctx context.Context, account, ip string) (time.Duration, error) {
+	now := t.Now()
+	attempts, err := t.Store.RecordFailure(ctx, accountKey(account), now, now.Add(-t.Account.Window))
+	if err != nil {
+		return 0, err
+	}
+	wait := t.Account.Wait(attempts, now)
+	if ip != "" {
+		attempts, err = t.Store.RecordFailure(ctx, ipKey(ip), now, now.Add(-t.IP.Window))
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, t.IP.Wait(attempts, now))
+	}
+	return wait, nil
+}
+
+// RecordSuccess clears the failures of account. The IP address keeps its
+// history, otherwise logging into an account of your own would reset it.
+func (t *LoginThrottle) RecordSuccess(ctx context.Context, account string) error {
+	return t.Store.Reset(ctx, accountKey(account))
+}
+
+// Unlock clears the failures of account, lifting any lockout.
+func (t *LoginThrottle) Unlock(ctx context.Context, account string) error {
+	return t.Store.Reset(ctx, accountKey(account))
+}
+
+// accountKey is keyed on the login name rather than a user ID so that
+// guesses against addresses with no account are throttled the same way.
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MemoryLoginAttemptStore is a LoginAttemptStore that lives only as long as
+// the process, so each instance of a replicated server throttles on its own.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]LoginAttempts)}
+}
+
+func (m *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, at, since time.Time) (LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(since)
+	attempts := m.attempts[key]
+	if attempts.LastFailure.Before(since) {
+		attempts = LoginAttempts{}
+	}
+	attempts.Failures++
+	attempts.LastFailure = at
+	m.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (m *MemoryLoginAttemptStore) Get(ctx context.Context, key string) (LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts[key], nil
+}
+
+func (m *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// pruneLocked drops stale keys once the map has grown, so clients that never
+// come back do not accumulate.
+func (m *MemoryLoginAttemptStore) pruneLocked(since time.Time) {
+	if len(m.attempts) < 1024 {
+		return
+	}
+	for key, attempts := range m.attempts {
+		if attempts.LastFailure.Before(since) {
+			delete(m.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottlePolicy_Wait(t *testing.T) {
+	policy := ThrottlePolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        8 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	last := time.Unix(1700000000, 0)
+	cases := []struct {
+		name     string
+		failures int
+		now      time.Time
+		want     time.Duration
+	}{
+		{"no failures", 0, last, 0},
+		{"free attempts", 3, last, 0},
+		{"first delay", 4, last, time.Second},
+		{"doubles", 6, last, 4 * time.Second},
+		{"capped", 9, last, 8 * time.Second},
+		{"partly waited", 6, last.Add(time.Second), 3 * time.Second},
+		{"delay over", 6, last.Add(time.Minute), 0},
+		{"locked out", 10, last.Add(time.Minute), 14 * time.Minute},
+		{"window passed", 10, last.Add(2 * time.Hour), 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := policy.Wait(LoginAttempts{Failures: tc.failures, LastFailure: last}, tc.now)
+			if got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	throttle := NewLoginThrottle(NewMemoryLoginAttemptStore())
+	throttle.Now = func() time.Time { return now }
+
+	for i := 0; i < throttle.Account.LockoutAfter; i++ {
+		if _, err := throttle.RecordFailure(ctx, "Walt@Example.com", "192.0.2.1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	wait, _ := throttle.Check(ctx, "walt@example.com", "192.0.2.2")
+	if wait != throttle.Account.LockoutDuration {
+		t.Errorf("expected the account to be locked for %s, got %s", throttle.Account.LockoutDuration, wait)
+	}
+	wait, _ = throttle.Check(ctx, "jesse@example.com", "192.0.2.1")
+	if wait != 0 {
+		t.Errorf("other accounts from the same IP should not be locked yet, got %s", wait)
+	}
+
+	if err := throttle.Unlock(ctx, "walt@example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait, _ = throttle.Check(ctx, "walt@example.com", "192.0.2.2"); wait != 0 {
+		t.Errorf("expected unlocked account to go ahead, got %s", wait)
+	}
+
+	for i := 0; i < throttle.IP.LockoutAfter; i++ {
+		throttle.RecordFailure(ctx, "", "192.0.2.3")
+	}
+	if wait, _ = throttle.Check(ctx, "saul@example.com", "192.0.2.3"); wait == 0 {
+		t.Errorf("expected the IP address to be locked out")
+	}
+
+	now = now.Add(throttle.IP.Window + time.Second)
+	if wait, _ = throttle.Check(ctx, "saul@example.com", "192.0.2.3"); wait != 0 {
+		t.Errorf("failures should be forgotten after the window, got %s", wait)
+	}
+}
+
+func TestMemoryLoginAttemptStore_ForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLoginAttemptStore()
+	start := time.Unix(1700000000, 0)
+	store.RecordFailure(ctx, "k", start, start.Add(-time.Hour))
+	store.RecordFailure(ctx, "k", start.Add(time.Minute), start.Add(-time.Hour))
+	later := start.Add(2 * time.Hour)
+	attempts, _ := store.RecordFailure(ctx, "k", later, later.Add(-time.Hour))
+	if attempts.Failures != 1 {
+		t.Errorf("expected a new streak of 1 failure, got %d", attempts.Failures)
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DefaultIssuer = "chirpy"
+
+// Errors returned by Validator.Validate. Each failure is wrapped in exactly
+// one of them so callers can tell them apart with errors.Is.
+var (
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenAlgorithm        = errors.New("token signing algorithm is not allowed")
+	ErrTokenUnverifiable     = errors.New("token cannot be verified")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token has expired")
+	ErrTokenNotYetValid      = errors.New("token is not valid yet")
+	ErrTokenIssuer           = errors.New("token has the wrong issuer")
+	ErrTokenAudience         = errors.New("token has the wrong audience")
+	ErrTokenSubject          = errors.New("token has an invalid subject")
+)
+
+// Validator checks access tokens. The zero values of the optional fields mean:
+// no audience check, every algorithm Keys can verify, no leeway and the system
+// clock.
+type Validator struct {
+	Keys       *KeyManager
+	Issuer     string
+	Audiences  []string
+	Algorithms []string
+	Leeway     time.Duration
+	Now        func() time.Time
+}
+
+// NewValidator returns a Validator for tokens issued by Chirpy and signed by
+// one of keys.
+func NewValidator(keys *KeyManager) *Validator {
+	return &Validator{Keys: keys, Issuer: DefaultIssuer}
+}
+
+// Validate verifies tokenString and returns its claims. Tokens issued before
+// roles existed are treated as belonging to a regular user.
+func (v *Validator) Validate(tokenString string) (*Claims, error) {
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	algorithms := v.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = v.Keys.Algorithms()
+	}
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		if !slices.Contains(algorithms, token.Method.Alg()) {
+			return nil, ErrTokenAlgorithm
+		}
+		return v.Keys.Keyfunc(token)
+	}
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, keyfunc,
+		jwt.WithLeeway(v.Leeway),
+		jwt.WithTimeFunc(now),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, classifyJWTError(err)
+	}
+	if claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("%w: %q", ErrTokenIssuer, claims.Issuer)
+	}
+	if len(v.Audiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.Audiences, aud)
+	}) {
+		return nil, fmt.Errorf("%w: %v", ErrTokenAudience, claims.Audience)
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenSubject, err)
+	}
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+	return &claims, nil
+}
+
+// classifyJWTError maps an error from the jwt library onto our own errors,
+// keeping the original for logging.
+func classifyJWTError(err error) error {
+	var kind error
+	switch {
+	case errors.Is(err, ErrTokenAlgorithm):
+		return ErrTokenAlgorithm
+	case errors.Is(err, ErrUnknownKey):
+		kind = ErrTokenUnverifiable
+	case errors.Is(err, jwt.ErrTokenMalformed), errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		kind = ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		kind = ErrTokenSignatureInvalid
+	case errors.Is(err, jwt.ErrTokenExpired):
+		kind = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		kind = ErrTokenNotYetValid
+	default:
+		kind = ErrTokenMalformed
+	}
+	return fmt.Errorf("%w: %v", kind, err)
+}
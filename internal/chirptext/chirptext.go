@@ -0,0 +1,87 @@
+// Package chirptext pulls structured entities, hashtags and mentions, out of
+// the free text of a chirp.
+package chirptext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxTagLength = 64
+
+// Hashtags returns the distinct, lower-cased tags in body without their
+// leading '#'. A tag must start at a word boundary, may contain letters,
+// digits and underscores, and must contain at least one letter.
+func Hashtags(body string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, token := range tokensAfter(body, '#', isTagRune) {
+		if utf8.RuneCountInString(token) > maxTagLength || !strings.ContainsFunc(token, unicode.IsLetter) {
+			continue
+		}
+		tag := strings.ToLower(token)
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Mentions returns the distinct, lower-cased email addresses mentioned in
+// body as "@alice@example.com". Users have no handles, so a bare "@alice" is
+// not a mention, and neither is an address in running text without a
+// leading '@', such as "mail bob@example.com".
+func Mentions(body string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, token := range tokensAfter(body, '@', isMentionRune) {
+		token = strings.TrimRight(token, ".-@")
+		if !strings.Contains(token, "@") {
+			continue
+		}
+		mention := strings.ToLower(token)
+		if !seen[mention] {
+			seen[mention] = true
+			mentions = append(mentions, mention)
+		}
+	}
+	return mentions
+}
+
+// tokensAfter finds every occurrence of sigil at a word boundary and returns
+// the run of runes accepted by valid that follows it.
+func tokensAfter(body string, sigil rune, valid func(rune) bool) []string {
+	var tokens []string
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != sigil {
+			continue
+		}
+		if i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == sigil) {
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && valid(runes[j]) {
+			j++
+		}
+		if j > i+1 {
+			tokens = append(tokens, string(runes[i+1:j]))
+		}
+		i = j - 1
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+}
+
+func isTagRune(r rune) bool {
+	return isWordRune(r)
+}
+
+func isMentionRune(r rune) bool {
+	return isWordRune(r) || strings.ContainsRune(".+-@", r)
+}
@@ -0,0 +1,47 @@
+package chirptext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHashtags(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{"no tags here", nil},
+		{"#Go is fun #go", []string{"go"}},
+		{"ending a sentence #chirpy.", []string{"chirpy"}},
+		{"#snake_case and #CamelCase", []string{"snake_case", "camelcase"}},
+		{"issue#12 and #123 are not tags", nil},
+		{"##double #ünïcode", []string{"ünïcode"}},
+	}
+	for _, c := range cases {
+		actual := Hashtags(c.input)
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Hashtags(%q) = %v, expected %v", c.input, actual, c.expected)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{"nobody mentioned", nil},
+		{"hi @Alice@Example.com!", []string{"alice@example.com"}},
+		{"thanks @bob@example.com, and @BOB@example.com again.", []string{"bob@example.com"}},
+		{"bare handles like @bob are not mentions", nil},
+		{"mail bob@example.com for details", nil},
+		{"(@carol@example.org)", []string{"carol@example.org"}},
+		{"trailing @ sign", nil},
+	}
+	for _, c := range cases {
+		actual := Mentions(c.input)
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Mentions(%q) = %v, expected %v", c.input, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: accessTokenRevocation.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteExpiredRevokedAccessTokens = `-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredRevokedAccessTokens(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredRevokedAccessTokens)
+	return err
+}
+
+const isAccessTokenRevoked = `-- name: IsAccessTokenRevoked :one
+SELECT (
+    EXISTS (SELECT 1 FROM revoked_access_tokens r WHERE r.token_id = $1)
+    OR EXISTS (
+        SELECT 1 FROM access_token_cutoffs c
+        WHERE c.user_id = $2 AND c.revoked_before > $3
+    )
+)::boolean AS revoked
+`
+
+type IsAccessTokenRevokedParams struct {
+	TokenID  string
+	UserID   uuid.UUID
+	IssuedAt time.Time
+}
+
+func (q *Queries) IsAccessTokenRevoked(ctx context.Context, arg IsAccessTokenRevokedParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isAccessTokenRevoked, arg.TokenID, arg.UserID, arg.IssuedAt)
+	var revoked bool
+	err := row.Scan(&revoked)
+	return revoked, err
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (token_id, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (token_id) DO NOTHING
+`
+
+type RevokeAccessTokenParams struct {
+	TokenID   string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeAccessToken, arg.TokenID, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const revokeUserAccessTokens = `-- name: RevokeUserAccessTokens :exec
+INSERT INTO access_token_cutoffs (user_id, revoked_before)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET revoked_before = GREATEST(access_token_cutoffs.revoked_before, EXCLUDED.revoked_before)
+`
+
+type RevokeUserAccessTokensParams struct {
+	UserID        uuid.UUID
+	RevokedBefore time.Time
+}
+
+func (q *Queries) RevokeUserAccessTokens(ctx context.Context, arg RevokeUserAccessTokensParams) error {
+	_, err := q.db.ExecContext(ctx, revokeUserAccessTokens, arg.UserID, arg.RevokedBefore)
+	return err
+}
@@ -8,16 +8,24 @@ package database
 import (
 	"context"
 	"database/sql"
+
+	"github.com/google/uuid"
 )
 
 const checkRevokeStatus = `-- name: CheckRevokeStatus :one
-SELECT revoked_at FROM refresh_tokens
-WHERE token = $1
+SELECT revoked_at, user_id, family_id FROM refresh_tokens
+WHERE token_hash = $1
 `
 
-func (q *Queries) CheckRevokeStatus(ctx context.Context, token string) (sql.NullTime, error) {
-	row := q.db.QueryRowContext(ctx, checkRevokeStatus, token)
-	var revoked_at sql.NullTime
-	err := row.Scan(&revoked_at)
-	return revoked_at, err
+type CheckRevokeStatusRow struct {
+	RevokedAt sql.NullTime
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+}
+
+func (q *Queries) CheckRevokeStatus(ctx context.Context, tokenHash string) (CheckRevokeStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, checkRevokeStatus, tokenHash)
+	var i CheckRevokeStatusRow
+	err := row.Scan(&i.RevokedAt, &i.UserID, &i.FamilyID)
+	return i, err
 }
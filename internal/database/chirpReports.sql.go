@@ -0,0 +1,171 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: chirpReports.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createChirpReport = `-- name: CreateChirpReport :one
+INSERT INTO chirp_reports (id, chirp_id, reporter_id, reason, status, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    'open',
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING id, chirp_id, reason, created_at, reporter_id, status, resolved_at, resolved_by, resolution
+`
+
+type CreateChirpReportParams struct {
+	ChirpID    uuid.UUID
+	ReporterID uuid.NullUUID
+	Reason     string
+}
+
+func (q *Queries) CreateChirpReport(ctx context.Context, arg CreateChirpReportParams) (ChirpReport, error) {
+	row := q.db.QueryRowContext(ctx, createChirpReport, arg.ChirpID, arg.ReporterID, arg.Reason)
+	var i ChirpReport
+	err := row.Scan(
+		&i.ID,
+		&i.ChirpID,
+		&i.Reason,
+		&i.CreatedAt,
+		&i.ReporterID,
+		&i.Status,
+		&i.ResolvedAt,
+		&i.ResolvedBy,
+		&i.Resolution,
+	)
+	return i, err
+}
+
+const listChirpReports = `-- name: ListChirpReports :many
+SELECT chirp_reports.id, chirp_reports.chirp_id, chirp_reports.reason, chirp_reports.created_at, chirp_reports.reporter_id, chirp_reports.status, chirp_reports.resolved_at, chirp_reports.resolved_by, chirp_reports.resolution, chirps.body AS chirp_body, chirps.user_id AS chirp_user_id, chirps.hidden_at AS chirp_hidden_at
+FROM chirp_reports
+INNER JOIN chirps
+ON chirps.id = chirp_reports.chirp_id
+WHERE chirp_reports.status = $1
+ORDER BY chirp_reports.created_at
+`
+
+type ListChirpReportsRow struct {
+	ID            uuid.UUID
+	ChirpID       uuid.UUID
+	Reason        string
+	CreatedAt     time.Time
+	ReporterID    uuid.NullUUID
+	Status        string
+	ResolvedAt    sql.NullTime
+	ResolvedBy    uuid.NullUUID
+	Resolution    sql.NullString
+	ChirpBody     string
+	ChirpUserID   uuid.UUID
+	ChirpHiddenAt sql.NullTime
+}
+
+func (q *Queries) ListChirpReports(ctx context.Context, status string) ([]ListChirpReportsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReports, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpReportsRow
+	for rows.Next() {
+		var i ListChirpReportsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Reason,
+			&i.CreatedAt,
+			&i.ReporterID,
+			&i.Status,
+			&i.ResolvedAt,
+			&i.ResolvedBy,
+			&i.Resolution,
+			&i.ChirpBody,
+			&i.ChirpUserID,
+			&i.ChirpHiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resolveChirpReport = `-- name: ResolveChirpReport :one
+UPDATE chirp_reports
+SET status = 'resolved', resolved_at = NOW(), resolved_by = $2, resolution = $3
+WHERE id = $1 AND status = 'open'
+RETURNING id, chirp_id, reason, created_at, reporter_id, status, resolved_at, resolved_by, resolution
+`
+
+type ResolveChirpReportParams struct {
+	ID         uuid.UUID
+	ResolvedBy uuid.NullUUID
+	Resolution sql.NullString
+}
+
+func (q *Queries) ResolveChirpReport(ctx context.Context, arg ResolveChirpReportParams) (ChirpReport, error) {
+	row := q.db.QueryRowContext(ctx, resolveChirpReport, arg.ID, arg.ResolvedBy, arg.Resolution)
+	var i ChirpReport
+	err := row.Scan(
+		&i.ID,
+		&i.ChirpID,
+		&i.Reason,
+		&i.CreatedAt,
+		&i.ReporterID,
+		&i.Status,
+		&i.ResolvedAt,
+		&i.ResolvedBy,
+		&i.Resolution,
+	)
+	return i, err
+}
+
+const setChirpHidden = `-- name: SetChirpHidden :one
+UPDATE chirps
+SET hidden_at = CASE WHEN $1::boolean THEN COALESCE(hidden_at, NOW()) ELSE NULL END
+WHERE id = $2
+AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, parent_chirp_id, deleted_at, search_vector, hidden_at
+`
+
+type SetChirpHiddenParams struct {
+	Hidden bool
+	ID     uuid.UUID
+}
+
+func (q *Queries) SetChirpHidden(ctx context.Context, arg SetChirpHiddenParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, setChirpHidden, arg.Hidden, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ParentChirpID,
+		&i.DeletedAt,
+		&i.SearchVector,
+		&i.HiddenAt,
+	)
+	return i, err
+}
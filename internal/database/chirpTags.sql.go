@@ -0,0 +1,149 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: chirpTags.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const addChirpTag = `-- name: AddChirpTag :exec
+INSERT INTO chirp_tags (chirp_id, tag)
+VALUES ($1, $2)
+ON CONFLICT (chirp_id, tag) DO NOTHING
+`
+
+type AddChirpTagParams struct {
+	ChirpID uuid.UUID
+	Tag     string
+}
+
+func (q *Queries) AddChirpTag(ctx context.Context, arg AddChirpTagParams) error {
+	_, err := q.db.ExecContext(ctx, addChirpTag, arg.ChirpID, arg.Tag)
+	return err
+}
+
+const deleteChirpTags = `-- name: DeleteChirpTags :exec
+DELETE FROM chirp_tags
+WHERE chirp_id = $1
+`
+
+func (q *Queries) DeleteChirpTags(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirpTags, chirpID)
+	return err
+}
+
+const listChirpsByTag = `-- name: ListChirpsByTag :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_chirp_id, chirps.deleted_at, chirps.search_vector, chirps.hidden_at FROM chirps
+INNER JOIN chirp_tags
+ON chirp_tags.chirp_id = chirps.id
+WHERE chirp_tags.tag = $1
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND (
+    $2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type ListChirpsByTagParams struct {
+	Tag             string
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsByTag(ctx context.Context, arg ListChirpsByTagParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByTag,
+		arg.Tag,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentChirpID,
+			&i.DeletedAt,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const trendingTags = `-- name: TrendingTags :many
+SELECT chirp_tags.tag,
+    COUNT(*) AS chirp_count,
+    COUNT(DISTINCT chirps.user_id) AS author_count
+FROM chirp_tags
+INNER JOIN chirps
+ON chirps.id = chirp_tags.chirp_id
+WHERE chirps.created_at > $1
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+GROUP BY chirp_tags.tag
+ORDER BY author_count DESC, chirp_count DESC, chirp_tags.tag
+LIMIT $2
+`
+
+type TrendingTagsParams struct {
+	Since time.Time
+	Limit int32
+}
+
+type TrendingTagsRow struct {
+	Tag         string
+	ChirpCount  int64
+	AuthorCount int64
+}
+
+func (q *Queries) TrendingTags(ctx context.Context, arg TrendingTagsParams) ([]TrendingTagsRow, error) {
+	rows, err := q.db.QueryContext(ctx, trendingTags, arg.Since, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TrendingTagsRow
+	for rows.Next() {
+		var i TrendingTagsRow
+		if err := rows.Scan(&i.Tag, &i.ChirpCount, &i.AuthorCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
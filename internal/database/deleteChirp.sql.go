@@ -11,6 +11,20 @@ import (
 	"github.com/google/uuid"
 )
 
+const chirpHasReplies = `-- name: ChirpHasReplies :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE parent_chirp_id = $1
+)
+`
+
+func (q *Queries) ChirpHasReplies(ctx context.Context, parentChirpID uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpHasReplies, parentChirpID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const deleteChirp = `-- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1
@@ -20,3 +34,27 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, deleteChirp, id)
 	return err
 }
+
+const lockChirp = `-- name: LockChirp :exec
+SELECT id FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+// Held while deciding between DeleteChirp and TombstoneChirp: inserting a
+// reply has to wait for it, since the foreign key check locks the parent.
+func (q *Queries) LockChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, lockChirp, id)
+	return err
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
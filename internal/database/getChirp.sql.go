@@ -12,12 +12,24 @@ import (
 )
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, parent_chirp_id, deleted_at, search_vector, hidden_at FROM chirps
 WHERE id = $1
+AND deleted_at IS NULL
+AND (
+    hidden_at IS NULL
+    OR user_id = $2::uuid
+    OR $3::boolean
+)
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
+type GetChirpParams struct {
+	ID                uuid.UUID
+	ViewerID          uuid.NullUUID
+	ViewerIsModerator bool
+}
+
+func (q *Queries) GetChirp(ctx context.Context, arg GetChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, arg.ID, arg.ViewerID, arg.ViewerIsModerator)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -25,6 +37,10 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentChirpID,
+		&i.DeletedAt,
+		&i.SearchVector,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -0,0 +1,78 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: loginFailures.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const deleteLoginFailures = `-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1
+`
+
+func (q *Queries) DeleteLoginFailures(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteLoginFailures, key)
+	return err
+}
+
+const deleteStaleLoginFailures = `-- name: DeleteStaleLoginFailures :exec
+DELETE FROM login_failures
+WHERE last_failure_at < $1
+`
+
+func (q *Queries) DeleteStaleLoginFailures(ctx context.Context, lastFailureAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteStaleLoginFailures, lastFailureAt)
+	return err
+}
+
+const getLoginFailures = `-- name: GetLoginFailures :one
+SELECT failures, last_failure_at FROM login_failures
+WHERE key = $1
+`
+
+type GetLoginFailuresRow struct {
+	Failures      int32
+	LastFailureAt time.Time
+}
+
+func (q *Queries) GetLoginFailures(ctx context.Context, key string) (GetLoginFailuresRow, error) {
+	row := q.db.QueryRowContext(ctx, getLoginFailures, key)
+	var i GetLoginFailuresRow
+	err := row.Scan(&i.Failures, &i.LastFailureAt)
+	return i, err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_failures (key, failures, last_failure_at)
+VALUES ($1, 1, $2)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failure_at < $3 THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failure_at = EXCLUDED.last_failure_at
+RETURNING failures, last_failure_at
+`
+
+type RecordLoginFailureParams struct {
+	Key      string
+	FailedAt time.Time
+	Since    time.Time
+}
+
+type RecordLoginFailureRow struct {
+	Failures      int32
+	LastFailureAt time.Time
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (RecordLoginFailureRow, error) {
+	row := q.db.QueryRowContext(ctx, recordLoginFailure, arg.Key, arg.FailedAt, arg.Since)
+	var i RecordLoginFailureRow
+	err := row.Scan(&i.Failures, &i.LastFailureAt)
+	return i, err
+}
@@ -0,0 +1,43 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: moderation.sql
+
+package database
+
+import (
+	"context"
+)
+
+const listModerationWords = `-- name: ListModerationWords :many
+SELECT word, action FROM moderation_words
+ORDER BY word
+`
+
+type ListModerationWordsRow struct {
+	Word   string
+	Action string
+}
+
+func (q *Queries) ListModerationWords(ctx context.Context) ([]ListModerationWordsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listModerationWords)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListModerationWordsRow
+	for rows.Next() {
+		var i ListModerationWordsRow
+		if err := rows.Scan(&i.Word, &i.Action); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
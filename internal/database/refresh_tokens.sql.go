@@ -7,39 +7,134 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, last_used_at, user_id, expires_at, family_id, user_agent, ip_address, access_token_id, access_token_expires_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
+    NOW(),
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, last_used_at, user_agent, ip_address, access_token_id, access_token_expires_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
+	TokenHash            string
+	UserID               uuid.UUID
+	ExpiresAt            time.Time
+	FamilyID             uuid.UUID
+	UserAgent            string
+	IpAddress            string
+	AccessTokenID        sql.NullString
+	AccessTokenExpiresAt sql.NullTime
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.AccessTokenID,
+		arg.AccessTokenExpiresAt,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.LastUsedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.AccessTokenID,
+		&i.AccessTokenExpiresAt,
 	)
 	return i, err
 }
+
+const listSessionAccessTokens = `-- name: ListSessionAccessTokens :many
+SELECT access_token_id::text AS token_id, access_token_expires_at::timestamp AS expires_at
+FROM refresh_tokens
+WHERE family_id = $1
+AND access_token_id IS NOT NULL
+AND access_token_expires_at > NOW()
+`
+
+type ListSessionAccessTokensRow struct {
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Access tokens issued in a session that have not expired yet.
+func (q *Queries) ListSessionAccessTokens(ctx context.Context, familyID uuid.UUID) ([]ListSessionAccessTokensRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionAccessTokens, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSessionAccessTokensRow
+	for rows.Next() {
+		var i ListSessionAccessTokensRow
+		if err := rows.Scan(&i.TokenID, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markRefreshTokenReplaced = `-- name: MarkRefreshTokenReplaced :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2
+WHERE token_hash = $1
+`
+
+type MarkRefreshTokenReplacedParams struct {
+	TokenHash  string
+	ReplacedBy sql.NullString
+}
+
+func (q *Queries) MarkRefreshTokenReplaced(ctx context.Context, arg MarkRefreshTokenReplacedParams) error {
+	_, err := q.db.ExecContext(ctx, markRefreshTokenReplaced, arg.TokenHash, arg.ReplacedBy)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
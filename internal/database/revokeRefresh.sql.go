@@ -13,15 +13,15 @@ import (
 const revokeRefresh = `-- name: RevokeRefresh :exec
 UPDATE refresh_tokens
 SET updated_at = $1, revoked_at = $1
-WHERE token = $2 AND revoked_at IS NULL
+WHERE token_hash = $2 AND revoked_at IS NULL
 `
 
 type RevokeRefreshParams struct {
 	UpdatedAt time.Time
-	Token     string
+	TokenHash string
 }
 
 func (q *Queries) RevokeRefresh(ctx context.Context, arg RevokeRefreshParams) error {
-	_, err := q.db.ExecContext(ctx, revokeRefresh, arg.UpdatedAt, arg.Token)
+	_, err := q.db.ExecContext(ctx, revokeRefresh, arg.UpdatedAt, arg.TokenHash)
 	return err
 }
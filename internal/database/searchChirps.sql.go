@@ -0,0 +1,88 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: searchChirps.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_chirp_id, chirps.deleted_at, chirps.search_vector, chirps.hidden_at,
+    ts_rank(chirps.search_vector, to_tsquery('english', $1)) AS rank,
+    ts_headline(
+        'english',
+        chirps.body,
+        to_tsquery('english', $1),
+        'StartSel=, StopSel=, MinWords=5, MaxWords=20'
+    )::text AS snippet
+FROM chirps
+WHERE chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirps.search_vector @@ to_tsquery('english', $1)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $3 OFFSET $2
+`
+
+type SearchChirpsParams struct {
+	Query  string
+	Offset int32
+	Limit  int32
+}
+
+type SearchChirpsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.UUID
+	ParentChirpID uuid.NullUUID
+	DeletedAt     sql.NullTime
+	SearchVector  interface{}
+	HiddenAt      sql.NullTime
+	Rank          float32
+	Snippet       string
+}
+
+// Matches in snippet are delimited by U+E000 and U+E001 (search.HighlightStart
+// and HighlightStop) rather than markup, since the body is user-written.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps, arg.Query, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentChirpID,
+			&i.DeletedAt,
+			&i.SearchVector,
+			&i.HiddenAt,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	data, err := Format("Chirpy <noreply@chirpy.test>", Message{
+		To:      "walt@example.com",
+		Subject: "Verify your email",
+		Body:    "line one\nline two",
+	}, date)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"From: Chirpy <noreply@chirpy.test>\r\n",
+		"To: walt@example.com\r\n",
+		"Subject: Verify your email\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected message to contain %q, got %q", want, got)
+		}
+	}
+}
+
+func TestFormat_RejectsHeaderInjection(t *testing.T) {
+	_, err := Format("noreply@chirpy.test", Message{
+		To:      "walt@example.com\r\nBcc: everyone@example.com",
+		Subject: "hi",
+	}, time.Now())
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWriterMailer("noreply@chirpy.test", &buf)
+	err := m.Send(context.Background(), Message{To: "walt@example.com", Subject: "hi", Body: "token: abc"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "token: abc") {
+		t.Errorf("expected the body to be written, got %q", buf.String())
+	}
+}
@@ -0,0 +1,94 @@
+// Package moderation decides what happens to user supplied text before it is
+// stored. Text is passed through an ordered Chain of Filters, each of which
+// can mask parts of it, flag it for human review or reject it outright.
+package moderation
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Action int
+
+const (
+	ActionAllow Action = iota
+	ActionMask
+	ActionFlag
+	ActionReject
+)
+
+const mask = "****"
+
+func (a Action) String() string {
+	switch a {
+	case ActionAllow:
+		return "allow"
+	case ActionMask:
+		return "mask"
+	case ActionFlag:
+		return "flag"
+	case ActionReject:
+		return "reject"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction converts the name used in configuration files and the database
+// into an Action.
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "mask":
+		return ActionMask, nil
+	case "flag":
+		return ActionFlag, nil
+	case "reject":
+		return ActionReject, nil
+	}
+	return ActionAllow, fmt.Errorf("unknown moderation action %q", s)
+}
+
+// Finding is a single rule that matched. Masking findings have already been
+// applied to the text a Filter returns; flag and reject findings carry a
+// reason that is shown to moderators or to the author.
+type Finding struct {
+	Action Action
+	Reason string
+}
+
+type Filter interface {
+	Check(text string) (string, []Finding)
+}
+
+// Result is the outcome of running text through a Chain.
+type Result struct {
+	Text     string
+	Rejected bool
+	Flagged  bool
+	Reasons  []string
+}
+
+// Chain runs its filters in order, feeding each the text produced by the one
+// before. The first rejection stops the chain.
+type Chain []Filter
+
+func (c Chain) Run(text string) Result {
+	res := Result{Text: text}
+	for _, filter := range c {
+		var findings []Finding
+		res.Text, findings = filter.Check(res.Text)
+		for _, finding := range findings {
+			switch finding.Action {
+			case ActionReject:
+				return Result{
+					Text:     res.Text,
+					Rejected: true,
+					Reasons:  []string{finding.Reason},
+				}
+			case ActionFlag:
+				res.Flagged = true
+				res.Reasons = append(res.Reasons, finding.Reason)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package moderation
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWordList_Masks(t *testing.T) {
+	chain := Chain{NewWordList(DefaultWords)}
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"I had something interesting for breakfast", "I had something interesting for breakfast"},
+		{"I hear Mastodon is better than Chirpy. sharbert I need to migrate", "I hear Mastodon is better than Chirpy. **** I need to migrate"},
+		{"I really need a kerfuffle to go to bed sooner, Fornax !", "I really need a **** to go to bed sooner, **** !"},
+		{"what a kerfuffle!", "what a ****!"},
+		{"Sharbert.", "****."},
+		{"(FORNAX)\tkerfuffle", "(****)\t****"},
+		{"kerfuffles are fine", "kerfuffles are fine"},
+	}
+	for _, c := range cases {
+		res := chain.Run(c.input)
+		if res.Text != c.expected {
+			t.Errorf("Run(%q).Text = %q, expected %q", c.input, res.Text, c.expected)
+		}
+		if res.Rejected || res.Flagged {
+			t.Errorf("Run(%q): masking should not reject or flag", c.input)
+		}
+	}
+}
+
+func TestWordList_Unicode(t *testing.T) {
+	chain := Chain{NewWordList([]WordRule{{Word: "ÜBEL", Action: ActionMask}})}
+	res := chain.Run("das ist übel, wirklich Übel!")
+	expected := "das ist ****, wirklich ****!"
+	if res.Text != expected {
+		t.Errorf("expected %q, got %q", expected, res.Text)
+	}
+}
+
+func TestChain_RejectStopsChain(t *testing.T) {
+	flagged := &RegexFilter{Rules: []RegexRule{{
+		Pattern: regexp.MustCompile(`.`),
+		Action:  ActionFlag,
+		Reason:  "should not run",
+	}}}
+	chain := Chain{
+		NewWordList([]WordRule{{Word: "slur", Action: ActionReject}}),
+		flagged,
+	}
+	res := chain.Run("that is a slur.")
+	if !res.Rejected {
+		t.Fatalf("expected chirp to be rejected")
+	}
+	if len(res.Reasons) != 1 || !strings.Contains(res.Reasons[0], "slur") {
+		t.Errorf("unexpected reasons: %v", res.Reasons)
+	}
+}
+
+func TestChain_FlagKeepsText(t *testing.T) {
+	chain := Chain{
+		NewWordList(DefaultWords),
+		&RegexFilter{Rules: []RegexRule{{
+			Pattern: regexp.MustCompile(`(?i)buy now`),
+			Action:  ActionFlag,
+			Reason:  "looks like an advert",
+		}}},
+	}
+	res := chain.Run("Buy now, fornax")
+	if res.Rejected || !res.Flagged {
+		t.Fatalf("expected flag without rejection, got %+v", res)
+	}
+	if res.Text != "Buy now, ****" {
+		t.Errorf("unexpected text %q", res.Text)
+	}
+	if len(res.Reasons) != 1 || res.Reasons[0] != "looks like an advert" {
+		t.Errorf("unexpected reasons: %v", res.Reasons)
+	}
+}
+
+func TestRegexFilter_Mask(t *testing.T) {
+	chain := Chain{&RegexFilter{Rules: []RegexRule{{
+		Pattern: regexp.MustCompile(`\b\d{3}-\d{4}\b`),
+		Action:  ActionMask,
+	}}}}
+	res := chain.Run("call me on 555-1234")
+	if res.Text != "call me on ****" {
+		t.Errorf("unexpected text %q", res.Text)
+	}
+}
+
+func TestSpamFilter(t *testing.T) {
+	filter := &SpamFilter{
+		MaxLinks:        2,
+		BlockedDomains:  []string{"spam.example"},
+		MaxRepeatedRune: 8,
+		Action:          ActionReject,
+	}
+	cases := []struct {
+		input    string
+		rejected bool
+	}{
+		{"see https://chirpy.example/about", false},
+		{"http://a.example http://b.example http://c.example", true},
+		{"deals at www.shop.spam.example/now", true},
+		{"noooooooooooo", true},
+		{"nooooo", false},
+	}
+	for _, c := range cases {
+		res := Chain{filter}.Run(c.input)
+		if res.Rejected != c.rejected {
+			t.Errorf("Run(%q).Rejected = %v, expected %v", c.input, res.Rejected, c.rejected)
+		}
+	}
+}
+
+func TestParseWordList(t *testing.T) {
+	input := "# comment\nkerfuffle\n\nspammer flag\nslur reject\n"
+	rules, err := ParseWordList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []WordRule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "spammer", Action: ActionFlag},
+		{Word: "slur", Action: ActionReject},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(rules))
+	}
+	for i := range expected {
+		if rules[i] != expected[i] {
+			t.Errorf("rule %d: expected %+v, got %+v", i, expected[i], rules[i])
+		}
+	}
+	if _, err := ParseWordList(strings.NewReader("word explode\n")); err == nil {
+		t.Errorf("expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,139 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type RegexRule struct {
+	Pattern *regexp.Regexp
+	Action  Action
+	Reason  string
+}
+
+// RegexFilter applies each rule in turn. Masking rules replace every match.
+type RegexFilter struct {
+	Rules []RegexRule
+}
+
+func (rf *RegexFilter) Check(text string) (string, []Finding) {
+	var findings []Finding
+	for _, rule := range rf.Rules {
+		if !rule.Pattern.MatchString(text) {
+			continue
+		}
+		if rule.Action == ActionMask {
+			text = rule.Pattern.ReplaceAllString(text, mask)
+		}
+		findings = append(findings, Finding{Action: rule.Action, Reason: rule.Reason})
+	}
+	return text, findings
+}
+
+// LoadRegexRulesFile reads a JSON array of rules of the form
+// {"pattern": "...", "action": "reject", "reason": "..."}.
+func LoadRegexRulesFile(path string) ([]RegexRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Pattern string `json:"pattern"`
+		Action  string `json:"action"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	rules := make([]RegexRule, len(raw))
+	for i, r := range raw {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		action, err := ParseAction(r.Action)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		rules[i] = RegexRule{Pattern: pattern, Action: action, Reason: r.Reason}
+	}
+	return rules, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// SpamFilter looks for the usual signs of link spam: too many links, links
+// to blocked domains and long runs of a single repeated character.
+type SpamFilter struct {
+	MaxLinks        int
+	BlockedDomains  []string
+	MaxRepeatedRune int
+	Action          Action
+}
+
+func (sf *SpamFilter) Check(text string) (string, []Finding) {
+	var findings []Finding
+	links := linkPattern.FindAllString(text, -1)
+	if sf.MaxLinks > 0 && len(links) > sf.MaxLinks {
+		findings = append(findings, Finding{
+			Action: sf.Action,
+			Reason: fmt.Sprintf("contains more than %d links", sf.MaxLinks),
+		})
+	}
+	for _, link := range links {
+		if domain := linkDomain(link); sf.isBlocked(domain) {
+			findings = append(findings, Finding{
+				Action: sf.Action,
+				Reason: fmt.Sprintf("links to the blocked domain %q", domain),
+			})
+		}
+	}
+	if sf.MaxRepeatedRune > 0 && longestRun(text) > sf.MaxRepeatedRune {
+		findings = append(findings, Finding{
+			Action: sf.Action,
+			Reason: "contains a long run of repeated characters",
+		})
+	}
+	return text, findings
+}
+
+func (sf *SpamFilter) isBlocked(domain string) bool {
+	for _, blocked := range sf.BlockedDomains {
+		if domain == blocked || strings.HasSuffix(domain, "."+blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+func linkDomain(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func longestRun(text string) int {
+	longest, current := 0, 0
+	var prev rune
+	for i, r := range text {
+		if i > 0 && r == prev {
+			current++
+		} else {
+			current = 1
+		}
+		prev = r
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
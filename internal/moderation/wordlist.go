@@ -0,0 +1,113 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type WordRule struct {
+	Word   string
+	Action Action
+}
+
+// DefaultWords is used when no word list has been configured.
+var DefaultWords = []WordRule{
+	{Word: "kerfuffle", Action: ActionMask},
+	{Word: "sharbert", Action: ActionMask},
+	{Word: "fornax", Action: ActionMask},
+}
+
+// WordList matches whole words regardless of case. Words are runs of Unicode
+// letters and digits, so punctuation next to a word does not hide it.
+type WordList struct {
+	words map[string]Action
+}
+
+func NewWordList(rules []WordRule) *WordList {
+	words := make(map[string]Action, len(rules))
+	for _, rule := range rules {
+		words[strings.ToLower(rule.Word)] = rule.Action
+	}
+	return &WordList{words: words}
+}
+
+func (wl *WordList) Check(text string) (string, []Finding) {
+	var findings []Finding
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		action, ok := wl.words[strings.ToLower(word)]
+		switch {
+		case !ok:
+			out.WriteString(word)
+		case action == ActionMask:
+			out.WriteString(mask)
+			findings = append(findings, Finding{Action: ActionMask})
+		default:
+			out.WriteString(word)
+			findings = append(findings, Finding{
+				Action: action,
+				Reason: fmt.Sprintf("contains the blocked word %q", strings.ToLower(word)),
+			})
+		}
+		i = j
+	}
+	return out.String(), findings
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// ParseWordList reads one word per line, optionally followed by the action to
+// take ("mask", "flag" or "reject"). Words without an action are masked.
+// Blank lines and lines starting with '#' are ignored.
+func ParseWordList(r io.Reader) ([]WordRule, error) {
+	var rules []WordRule
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		rule := WordRule{Word: fields[0], Action: ActionMask}
+		if len(fields) > 1 {
+			action, err := ParseAction(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			rule.Action = action
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func LoadWordListFile(path string) ([]WordRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseWordList(f)
+}
@@ -0,0 +1,253 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID Connect provider. Codes are registered
+// with authorize, standing in for the user logging in at the provider.
+type mockProvider struct {
+	server   *httptest.Server
+	clientID string
+	secret   string
+
+	mu    sync.Mutex
+	kid   string
+	key   *rsa.PrivateKey
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	m := &mockProvider{clientID: "chirpy", secret: "s3cret", codes: make(map[string]mockGrant)}
+	m.rotate(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		pub := m.key.PublicKey
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": m.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		m.mu.Lock()
+		grant, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if id != m.clientID || secret != m.secret || !ok || CodeChallenge(r.FormValue("code_verifier")) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "unused",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(t, grant.claims),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) rotate(t *testing.T) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	kid, _ := RandomString()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.key, m.kid = key, kid
+}
+
+func (m *mockProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            m.clientID,
+		"sub":            "user-1234",
+		"email":          "walt@example.com",
+		"email_verified": true,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func (m *mockProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// authorize plays the user logging in at the provider: it reads the
+// authorization request and returns the code the callback would receive.
+func (m *mockProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("bad authorization URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != m.clientID {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	code, _ := RandomString()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), claims: claims}
+	return code
+}
+
+func discoverMock(t *testing.T, m *mockProvider) *Provider {
+	t.Helper()
+	p, err := Discover(context.Background(), m.server.Client(), "mock", m.server.URL, m.clientID, m.secret, "http://localhost:8080/api/auth/mock/callback")
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	return p
+}
+
+func TestLoginFlow(t *testing.T) {
+	ctx := context.Background()
+	m := newMockProvider(t)
+	p := discoverMock(t, m)
+
+	state, _ := RandomString()
+	nonce, _ := RandomString()
+	verifier, _ := RandomString()
+	code := m.authorize(t, p.AuthCodeURL(state, nonce, verifier), m.claims(nonce))
+
+	raw, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	idToken, err := p.Verify(ctx, raw, nonce)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if idToken.Subject != "user-1234" || idToken.Email != "walt@example.com" || !idToken.EmailVerified {
+		t.Errorf("unexpected id token %+v", idToken)
+	}
+}
+
+func TestExchange_RequiresCodeVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := discoverMock(t, m)
+	verifier, _ := RandomString()
+	code := m.authorize(t, p.AuthCodeURL("state", "nonce", verifier), m.claims("nonce"))
+
+	stolen, _ := RandomString()
+	if _, err := p.Exchange(context.Background(), code, stolen); !errors.Is(err, ErrTokenExchange) {
+		t.Errorf("expected ErrTokenExchange for the wrong verifier, got %v", err)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	m := newMockProvider(t)
+	p := discoverMock(t, m)
+	cases := []struct {
+		name  string
+		edit  func(jwt.MapClaims)
+		token func(jwt.MapClaims) string
+		want  error
+	}{
+		{name: "wrong nonce", edit: func(c jwt.MapClaims) { c["nonce"] = "replayed" }, want: ErrNonce},
+		{name: "wrong audience", edit: func(c jwt.MapClaims) { c["aud"] = "someone-else" }, want: ErrInvalidToken},
+		{name: "wrong issuer", edit: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, want: ErrInvalidToken},
+		{name: "expired", edit: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, want: ErrInvalidToken},
+		{name: "no subject", edit: func(c jwt.MapClaims) { delete(c, "sub") }, want: ErrInvalidToken},
+		{
+			name: "other party",
+			edit: func(c jwt.MapClaims) { c["aud"] = []string{m.clientID, "other"}; c["azp"] = "other" },
+			want: ErrInvalidToken,
+		},
+		{
+			name: "signed with client secret",
+			token: func(c jwt.MapClaims) string {
+				signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte(m.secret))
+				return signed
+			},
+			want: ErrInvalidToken,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := m.claims("nonce")
+			var raw string
+			if tc.edit != nil {
+				tc.edit(claims)
+			}
+			if tc.token != nil {
+				raw = tc.token(claims)
+			} else {
+				raw = m.sign(t, claims)
+			}
+			if _, err := p.Verify(context.Background(), raw, "nonce"); !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestVerify_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	m := newMockProvider(t)
+	p := discoverMock(t, m)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if _, err := p.Verify(ctx, m.sign(t, m.claims("nonce")), "nonce"); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	m.rotate(t)
+	rotated := m.sign(t, m.claims("nonce"))
+	if _, err := p.Verify(ctx, rotated, "nonce"); err == nil {
+		t.Errorf("keys should not be fetched again straight away")
+	}
+	now = now.Add(minKeyRefresh)
+	if _, err := p.Verify(ctx, rotated, "nonce"); err != nil {
+		t.Errorf("expected the new key to be picked up, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Package ratelimit limits how often something may happen per key, such as
+// per client IP address.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaxKeys is how many keys a Limiter tracks before it starts pruning
+// windows that have ended.
+const defaultMaxKeys = 10000
+
+// Limiter allows up to limit events per key in a fixed window. It keeps its
+// state in memory, so each server instance limits on its own.
+type Limiter struct {
+	limit   int
+	window  time.Duration
+	maxKeys int
+	now     func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		window:  window,
+		maxKeys: defaultMaxKeys,
+		now:     time.Now,
+		windows: make(map[string]rateWindow),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit.
+// When it is not, retryAfter says how long until the window resets.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.windows) > l.maxKeys {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+	}
+	w := l.windows[key]
+	if now.Sub(w.start) >= l.window {
+		w = rateWindow{start: now}
+	}
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	l.windows[key] = w
+	return true, 0
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	cases := []struct {
+		name      string
+		after     time.Duration
+		key       string
+		wantOK    bool
+		wantRetry time.Duration
+	}{
+		{"first", 0, "192.0.2.1", true, 0},
+		{"second", time.Second, "192.0.2.1", true, 0},
+		{"third", 2 * time.Second, "192.0.2.1", true, 0},
+		{"over the limit", 5 * time.Second, "192.0.2.1", false, 55 * time.Second},
+		{"other key", 5 * time.Second, "192.0.2.2", true, 0},
+		{"just before reset", time.Minute - time.Nanosecond, "192.0.2.1", false, time.Nanosecond},
+		{"window reset", time.Minute, "192.0.2.1", true, 0},
+		{"new window counts", time.Minute + time.Second, "192.0.2.1", true, 0},
+		{"new window limit", time.Minute + 2*time.Second, "192.0.2.1", true, 0},
+		{"new window over", time.Minute + 3*time.Second, "192.0.2.1", false, 57 * time.Second},
+	}
+	l := New(3, time.Minute)
+	var now time.Time
+	l.now = func() time.Time { return now }
+	for _, tc := range cases {
+		now = start.Add(tc.after)
+		ok, retry := l.Allow(tc.key)
+		if ok != tc.wantOK || retry != tc.wantRetry {
+			t.Errorf("%s: expected (%v, %s), got (%v, %s)", tc.name, tc.wantOK, tc.wantRetry, ok, retry)
+		}
+	}
+}
+
+func TestLimiter_Prunes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New(1, time.Minute)
+	l.maxKeys = 5
+	l.now = func() time.Time { return now }
+	for i := 0; i < 6; i++ {
+		l.Allow(fmt.Sprintf("192.0.2.%d", i))
+	}
+	if len(l.windows) != 6 {
+		t.Fatalf("expected 6 windows, got %d", len(l.windows))
+	}
+
+	now = now.Add(30 * time.Second)
+	l.Allow("198.51.100.1")
+	if len(l.windows) != 7 {
+		t.Errorf("windows still running should not be pruned, got %d", len(l.windows))
+	}
+
+	now = now.Add(30 * time.Second)
+	l.Allow("198.51.100.2")
+	if len(l.windows) != 2 {
+		t.Errorf("expected ended windows to be pruned, got %d left", len(l.windows))
+	}
+	if ok, _ := l.Allow("198.51.100.1"); ok {
+		t.Errorf("pruning should keep windows that are still running")
+	}
+}
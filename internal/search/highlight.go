@@ -0,0 +1,47 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// Delimiters SearchChirps asks ts_headline to put around matched words. They
+// are private use characters rather than markup so that the snippet can be
+// HTML-escaped before the highlights are added.
+const (
+	HighlightStart = "\uE000"
+	HighlightStop  = "\uE001"
+)
+
+// HighlightHTML turns a ts_headline snippet into HTML that is safe to render:
+// the chirp text is escaped and matches are wrapped in <mark>. Delimiters a
+// user typed into their chirp can only ever produce balanced <mark> tags.
+func HighlightHTML(snippet string) string {
+	var out strings.Builder
+	open := false
+	for {
+		i := strings.IndexAny(snippet, HighlightStart+HighlightStop)
+		if i < 0 {
+			break
+		}
+		out.WriteString(html.EscapeString(snippet[:i]))
+		if strings.HasPrefix(snippet[i:], HighlightStart) {
+			if !open {
+				out.WriteString("<mark>")
+				open = true
+			}
+			snippet = snippet[i+len(HighlightStart):]
+		} else {
+			if open {
+				out.WriteString("</mark>")
+				open = false
+			}
+			snippet = snippet[i+len(HighlightStop):]
+		}
+	}
+	out.WriteString(html.EscapeString(snippet))
+	if open {
+		out.WriteString("</mark>")
+	}
+	return out.String()
+}
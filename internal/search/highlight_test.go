@@ -0,0 +1,26 @@
+package search
+
+import "testing"
+
+func TestHighlightHTML(t *testing.T) {
+	cases := []struct {
+		name     string
+		snippet  string
+		expected string
+	}{
+		{"plain", "good morning", "good morning"},
+		{"match", "good " + HighlightStart + "morning" + HighlightStop, "good <mark>morning</mark>"},
+		{
+			"script in body",
+			`<script>alert("x")</script> ` + HighlightStart + "coffee" + HighlightStop,
+			`&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>coffee</mark>`,
+		},
+		{"markup inside match", HighlightStart + "<b>" + HighlightStop, "<mark>&lt;b&gt;</mark>"},
+		{"unbalanced delimiters", HighlightStart + HighlightStart + "a" + HighlightStop + HighlightStop + "b" + HighlightStart, "<mark>a</mark>b<mark></mark>"},
+	}
+	for _, c := range cases {
+		if actual := HighlightHTML(c.snippet); actual != c.expected {
+			t.Errorf("%s: HighlightHTML(%q) = %q, expected %q", c.name, c.snippet, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("search query has no searchable terms")
+
+// ToTSQuery converts a user supplied search string into the syntax understood
+// by Postgres' to_tsquery. Every term must match. Double quoted text is
+// matched as a phrase and a trailing '*' turns the last word of a term into a
+// prefix match. Anything that is not a letter or digit is treated as a word
+// separator, so the result never contains operators the user typed.
+func ToTSQuery(q string) (string, error) {
+	var terms []string
+	for _, group := range splitGroups(q) {
+		if term := buildTerm(group); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return "", ErrEmptyQuery
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+// splitGroups splits q on whitespace, keeping double quoted text together.
+// An unterminated quote runs to the end of the string.
+func splitGroups(q string) []string {
+	var groups []string
+	var current strings.Builder
+	inQuote := false
+	flush := func() {
+		if current.Len() > 0 {
+			groups = append(groups, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range q {
+		switch {
+		case r == '"':
+			flush()
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return groups
+}
+
+func buildTerm(group string) string {
+	prefix := strings.HasSuffix(strings.TrimSpace(group), "*")
+	words := strings.FieldsFunc(strings.ToLower(group), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	if prefix {
+		words[len(words)-1] += ":*"
+	}
+	return strings.Join(words, " <-> ")
+}
@@ -0,0 +1,42 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToTSQuery(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"hello", "hello"},
+		{"Hello World", "hello & world"},
+		{`"hello world"`, "hello <-> world"},
+		{"chirp*", "chirp:*"},
+		{`"good morn*" coffee`, "good <-> morn:* & coffee"},
+		{"e-mail", "e <-> mail"},
+		{"cats & !dogs | (birds)", "cats & dogs & birds"},
+		{`"unterminated phrase`, "unterminated <-> phrase"},
+		{"café", "café"},
+	}
+	for _, c := range cases {
+		actual, err := ToTSQuery(c.input)
+		if err != nil {
+			t.Errorf("ToTSQuery(%q): unexpected error: %v", c.input, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("ToTSQuery(%q) = %q, expected %q", c.input, actual, c.expected)
+		}
+	}
+}
+
+func TestToTSQuery_Empty(t *testing.T) {
+	for _, input := range []string{"", "   ", `""`, "&|!*"} {
+		_, err := ToTSQuery(input)
+		if !errors.Is(err, ErrEmptyQuery) {
+			t.Errorf("ToTSQuery(%q): expected ErrEmptyQuery, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+)
+
+// loadKeyManager sets up token signing from the environment. JWT_KEYS_DIR
+// holds one <kid>.pem file per key, JWT_ACTIVE_KID picks the one new tokens
+// are signed with and JWT_RETIRED_KIDS lists keys that are no longer
+// accepted. JWT_SECRET keeps HS256 tokens issued before the switch valid, and
+// is still used for signing when no key directory is configured. JWT_AUDIENCE
+// sets the audiences tokens are issued for.
+func loadKeyManager() (*auth.KeyManager, error) {
+	secret := os.Getenv("JWT_SECRET")
+	dir := os.Getenv("JWT_KEYS_DIR")
+	var keys *auth.KeyManager
+	if dir == "" {
+		keys = auth.NewHMACKeyManager(secret)
+	} else {
+		var retired []string
+		for _, kid := range strings.Split(os.Getenv("JWT_RETIRED_KIDS"), ",") {
+			if kid = strings.TrimSpace(kid); kid != "" {
+				retired = append(retired, kid)
+			}
+		}
+		var err error
+		keys, err = auth.LoadKeyManager(dir, os.Getenv("JWT_ACTIVE_KID"), retired, secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys.Audience = jwtAudiences()
+	return keys, nil
+}
+
+// accessTokenLeeway absorbs clock drift between us and services verifying our
+// tokens with the JWKS.
+const accessTokenLeeway = 30 * time.Second
+
+// jwtAudiences reads the comma separated JWT_AUDIENCE. New tokens carry all of
+// them and incoming tokens must carry at least one.
+func jwtAudiences() []string {
+	var audiences []string
+	for _, aud := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audiences = append(audiences, aud)
+		}
+	}
+	return audiences
+}
+
+func newTokenValidator(keys *auth.KeyManager) *auth.Validator {
+	validator := auth.NewValidator(keys)
+	validator.Audiences = keys.Audience
+	validator.Leeway = accessTokenLeeway
+	return validator
+}
+
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.keys.JWKS())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+// attachLikes fills in like_count, and liked_by_me when there is a viewer,
+// for every chirp using a single aggregate query.
+func (cfg *apiConfig) attachLikes(ctx context.Context, chirps []*Chirp, viewer uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+	stats, err := cfg.db.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+		ViewerID: viewer,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+	byChirp := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(stats))
+	for _, stat := range stats {
+		byChirp[stat.ChirpID] = stat
+	}
+	for _, chirp := range chirps {
+		stat := byChirp[chirp.ID]
+		chirp.LikeCount = stat.LikeCount
+		if viewer.Valid {
+			likedByMe := stat.LikedByMe
+			chirp.LikedByMe = &likedByMe
+		}
+	}
+	return nil
+}
+
+// attachLikesToPage is attachLikes for a slice of chirps held by value.
+func (cfg *apiConfig) attachLikesToPage(ctx context.Context, chirps []Chirp, viewer uuid.NullUUID) error {
+	ptrs := make([]*Chirp, len(chirps))
+	for i := range chirps {
+		ptrs[i] = &chirps[i]
+	}
+	return cfg.attachLikes(ctx, ptrs, viewer)
+}
+
+// chirpTarget parses the chirpID path value and makes sure the chirp exists
+// and is visible to userID.
+func (cfg *apiConfig) chirpTarget(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
+		return uuid.Nil, false
+	}
+	_, err = cfg.db.GetChirp(r.Context(), database.GetChirpParams{
+		ID:       chirpID,
+		ViewerID: uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return uuid.Nil, false
+		}
+		errorString := "Error when attempting to find chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return uuid.Nil, false
+	}
+	return chirpID, true
+}
+
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	chirpID, ok := cfg.chirpTarget(w, r, userID)
+	if !ok {
+		return
+	}
+	err := cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+	})
+	if err != nil {
+		errorString := "Error when attempting to like chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	chirpID, ok := cfg.chirpTarget(w, r, userID)
+	if !ok {
+		return
+	}
+	err := cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+	})
+	if err != nil {
+		errorString := "Error when attempting to unlike chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+// pgLoginAttemptStore keeps failed logins in Postgres so that every instance
+// of the server throttles the same attempts.
+type pgLoginAttemptStore struct {
+	db *database.Queries
+}
+
+func (s pgLoginAttemptStore) RecordFailure(ctx context.Context, key string, at, since time.Time) (auth.LoginAttempts, error) {
+	// Keys are only needed while their failures still count.
+	if err := s.db.DeleteStaleLoginFailures(ctx, since.UTC()); err != nil {
+		return auth.LoginAttempts{}, err
+	}
+	row, err := s.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:      key,
+		FailedAt: at.UTC(),
+		Since:    since.UTC(),
+	})
+	if err != nil {
+		return auth.LoginAttempts{}, err
+	}
+	return auth.LoginAttempts{Failures: int(row.Failures), LastFailure: row.LastFailureAt}, nil
+}
+
+func (s pgLoginAttemptStore) Get(ctx context.Context, key string) (auth.LoginAttempts, error) {
+	row, err := s.db.GetLoginFailures(ctx, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.LoginAttempts{}, nil
+		}
+		return auth.LoginAttempts{}, err
+	}
+	return auth.LoginAttempts{Failures: int(row.Failures), LastFailure: row.LastFailureAt}, nil
+}
+
+func (s pgLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.db.DeleteLoginFailures(ctx, key)
+}
+
+// loadLoginThrottle tracks failed logins in Postgres, unless
+// LOGIN_THROTTLE_STORE is "memory", which suits a single instance.
+func loadLoginThrottle(db *database.Queries) (*auth.LoginThrottle, error) {
+	switch store := os.Getenv("LOGIN_THROTTLE_STORE"); store {
+	case "", "postgres":
+		return auth.NewLoginThrottle(pgLoginAttemptStore{db: db}), nil
+	case "memory":
+		return auth.NewLoginThrottle(auth.NewMemoryLoginAttemptStore()), nil
+	default:
+		return nil, fmt.Errorf("unknown LOGIN_THROTTLE_STORE %q", store)
+	}
+}
+
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int((wait+time.Second-1)/time.Second)))
+}
+
+// adminUnlockUserHandler lifts a login lockout on a user's account.
+func (cfg *apiConfig) adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.loginThrottle.Unlock(r.Context(), user.Email)
+	if err != nil {
+		errorString := "Error when attempting to unlock user"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -6,25 +6,40 @@ import (
 	"github.com/google/uuid"
 
 	"os"
+	"context"
 	"database/sql"
 	"net/http"
 	"log"
 	"sync/atomic"
 	"fmt"
 	"encoding/json"
-	"strings"
 	"time"
 	"errors"
+	"strings"
 
 	"github.com/Rota-of-light/HTTPServer/internal/database"
 	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/moderation"
+	"github.com/Rota-of-light/HTTPServer/internal/mailer"
+	"github.com/Rota-of-light/HTTPServer/internal/oidc"
+	"github.com/Rota-of-light/HTTPServer/internal/ratelimit"
 )
 
 type apiConfig struct {
 	db		*database.Queries
+	dbConn	*sql.DB
 	fileserverHits atomic.Int32
 	platform	string
-	secret 		string
+	keys		*auth.KeyManager
+	moderation	moderation.Chain
+	revocations	auth.RevocationStore
+	mailer		mailer.Mailer
+	publicURL	string
+	forgotPasswordLimiter	*ratelimit.Limiter
+	loginThrottle	*auth.LoginThrottle
+	passwordPolicy	auth.PasswordPolicy
+	passwordHasher	*auth.PasswordHasher
+	oidcProviders	map[string]*oidc.Provider
 }
 
 type User struct {
@@ -32,6 +47,8 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	EmailVerified bool  `json:"email_verified"`
 	Token	  string	`json:"token"`
 	RefreshToken string `json:"refresh_token"`
 }
@@ -42,6 +59,30 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body     string    `json:"body"`
 	UserID	 uuid.UUID    `json:"user_id"`
+	InReplyTo *uuid.UUID  `json:"in_reply_to"`
+	LikeCount int64       `json:"like_count"`
+	LikedByMe *bool       `json:"liked_by_me,omitempty"`
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+	res := Chirp{
+		ID:			chirp.ID,
+		CreatedAt:	chirp.CreatedAt,
+		UpdatedAt:	chirp.UpdatedAt,
+		Body:		chirp.Body,
+		UserID:		chirp.UserID,
+	}
+	if chirp.ParentChirpID.Valid {
+		res.InReplyTo = &chirp.ParentChirpID.UUID
+	}
+	return res
+}
+
+// currentUserID returns the ID of the caller authenticated by
+// auth.Middleware. Handlers using it must sit behind RequireAuth.
+func currentUserID(r *http.Request) uuid.UUID {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	return principal.UserID
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -109,47 +150,61 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
     }
-	hash, err := auth.HashPassword(params.Password)
+	if !validEmail(params.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+	hash, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
+		if hasherBusy(w, err) {
+			return
+		}
 		errorString := "Something went wrong when working with password"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Something went wrong when attempting to create user"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 	userParams := database.CreateUserParams{
 		Email:	params.Email,
 		HashedPassword: hash,
 	}
-	user, err := cfg.db.CreateUser(r.Context(), userParams)
+	user, err := qtx.CreateUser(r.Context(), userParams)
 	if err != nil {
 		errorString := "Something went wrong when attempting to create user"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
+	verificationToken, err := createEmailVerification(r.Context(), qtx, user.ID, user.Email)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Something went wrong when attempting to create user"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	cfg.sendVerificationEmail(r.Context(), user.Email, verificationToken)
 	newUser := User{
 		ID:	user.ID,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Role: user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
 	respondWithJSON(w, http.StatusCreated, newUser)
 }
 
-func profaneChecker(s string) string {
-	profaneWords := map[string]bool{
-		"kerfuffle": true,
-		"sharbert":  true,
-		"fornax":    true,
-	}
-	splitS := strings.Split(s, " ")
-	for i, word := range splitS {
-		lower_word := strings.ToLower(word)
-		if profaneWords[lower_word] {
-			splitS[i] = "****"
-		}
-	}
-	return strings.Join(splitS, " ")
-}
-
 func respondWithError(w http.ResponseWriter, code int, msg string) {
 	type returnErr struct {
 		Error string `json:"error"`
@@ -185,18 +240,20 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 }
 
 func (cfg *apiConfig) chirpsHandler(w http.ResponseWriter, r *http.Request){
-    authString, err := auth.GetBearerToken(r.Header)
+	userID := currentUserID(r)
+	author, err := cfg.db.GetUserByID(r.Context(), userID)
 	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
 		return
-    }
-	userID, err := auth.ValidateJWT(authString, cfg.secret)
-	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
+	}
+	if !author.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address before posting chirps")
 		return
-    }
+	}
 	type parameters struct {
         Body string `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
     }
 	if r.Body == nil {
 		respondWithError(w, http.StatusBadRequest, "Request body missing")
@@ -210,50 +267,125 @@ func (cfg *apiConfig) chirpsHandler(w http.ResponseWriter, r *http.Request){
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
     }
-    if len(params.Body) > 140 {
-		errorString := "Chirp is too long"
-        respondWithError(w, http.StatusBadRequest, errorString)
-		return
+	moderated, err := cfg.moderateChirpBody(params.Body)
+	if err != nil {
+        respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	parentID := uuid.NullUUID{}
+	if params.InReplyTo != nil {
+		_, err = cfg.db.GetChirp(r.Context(), database.GetChirpParams{
+			ID:			*params.InReplyTo,
+			ViewerID:	uuid.NullUUID{UUID: userID, Valid: true},
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, http.StatusBadRequest, "Chirp being replied to does not exist")
+				return
+			}
+			errorString := "Error when attempting to find chirp being replied to"
+			respondWithError(w, http.StatusInternalServerError, errorString)
+			return
+		}
+		parentID = uuid.NullUUID{UUID: *params.InReplyTo, Valid: true}
 	}
-	cleanedString := profaneChecker(params.Body)
 	chirpParam := database.CreateChirpParams{
-		Body:   cleanedString,
+		Body:   moderated.Text,
 		UserID: userID,
+		ParentChirpID: parentID,
 	}
-	chirpRes, err := cfg.db.CreateChirp(r.Context(), chirpParam)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Error when attempting to create chirp"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	chirpRes, err := qtx.CreateChirp(r.Context(), chirpParam)
 	if err != nil {
 		errorString := "Error when attempting to create chirp"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
     }
-	chirpJSON := Chirp{
-		ID: chirpRes.ID,
-		CreatedAt: chirpRes.CreatedAt,
-		UpdatedAt: chirpRes.UpdatedAt,
-		Body: chirpRes.Body,
-		UserID: chirpRes.UserID,
-	}
-    respondWithJSON(w, http.StatusCreated, chirpJSON)
+	err = storeChirpEntities(r.Context(), qtx, chirpRes)
+	if err != nil {
+		errorString := "Error when attempting to store chirp tags and mentions"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = recordChirpFlags(r.Context(), qtx, chirpRes.ID, moderated)
+	if err != nil {
+		errorString := "Error when attempting to flag chirp for review"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		errorString := "Error when attempting to create chirp"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+    respondWithJSON(w, http.StatusCreated, chirpFromDB(chirpRes))
 }
 
 func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := cfg.db.AllChirps(r.Context())
+	sort := r.URL.Query().Get("sort")
+	if sort != "" && sort != "asc" && sort != "desc" {
+		respondWithError(w, http.StatusBadRequest, "sort must be 'asc' or 'desc'")
+		return
+	}
+	page, err := parsePageRequest(r, cursorChirps, sort == "desc")
 	if err != nil {
-		errorString := "Error when attempting to retrive all chirps"
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	authorID := uuid.NullUUID{}
+	if authorIDStr := r.URL.Query().Get("author_id"); authorIDStr != "" {
+		id, err := uuid.Parse(authorIDStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID format")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	viewer := optionalViewer(r)
+	var dbChirps []database.Chirp
+	if page.Descending {
+		dbChirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			ViewerID:			viewer.ID,
+			ViewerIsModerator:	viewer.IsModerator,
+			AuthorID:			authorID,
+			CursorCreatedAt:	page.cursorCreatedAt(),
+			CursorID:			page.cursorID(),
+			Limit:				page.Limit + 1,
+		})
+	} else {
+		dbChirps, err = cfg.db.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			ViewerID:			viewer.ID,
+			ViewerIsModerator:	viewer.IsModerator,
+			AuthorID:			authorID,
+			CursorCreatedAt:	page.cursorCreatedAt(),
+			CursorID:			page.cursorID(),
+			Limit:				page.Limit + 1,
+		})
+	}
+	if err != nil {
+		errorString := "Error when attempting to retrive chirps"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
     }
 	chirps := make([]Chirp, len(dbChirps))
 	for i, chirp := range dbChirps {
-		chirps[i] = Chirp{
-			ID:			chirp.ID,
-			CreatedAt:	chirp.CreatedAt,
-			UpdatedAt:	chirp.UpdatedAt,
-			Body:		chirp.Body,
-			UserID:		chirp.UserID,
-		}
+		chirps[i] = chirpFromDB(chirp)
+	}
+	err = cfg.attachLikesToPage(r.Context(), chirps, viewer.ID)
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
 	}
-	respondWithJSON(w, http.StatusOK, chirps)
+	respondWithJSON(w, http.StatusOK, newChirpPage(chirps, page))
 }
 
 func (cfg *apiConfig) getChirpByIDHandler(w http.ResponseWriter, r *http.Request) {
@@ -263,7 +395,12 @@ func (cfg *apiConfig) getChirpByIDHandler(w http.ResponseWriter, r *http.Request
         respondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
         return
     }
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	viewer := optionalViewer(r)
+	chirp, err := cfg.db.GetChirp(r.Context(), database.GetChirpParams{
+		ID:				chirpID,
+		ViewerID:		viewer.ID,
+		ViewerIsModerator:	viewer.IsModerator,
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			errorString := "Chirp not found"
@@ -274,12 +411,12 @@ func (cfg *apiConfig) getChirpByIDHandler(w http.ResponseWriter, r *http.Request
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
     }
-	chirpJSON := Chirp{
-		ID:			chirp.ID,
-		CreatedAt:	chirp.CreatedAt,
-		UpdatedAt:	chirp.UpdatedAt,
-		Body:		chirp.Body,
-		UserID:		chirp.UserID,
+	chirpJSON := chirpFromDB(chirp)
+	err = cfg.attachLikes(r.Context(), []*Chirp{&chirpJSON}, viewer.ID)
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
 	}
 	respondWithJSON(w, http.StatusOK, chirpJSON)
 }
@@ -302,21 +439,69 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
     }
 	
-	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	wait, err := cfg.loginThrottle.Check(r.Context(), params.Email, clientIP(r))
 	if err != nil {
-		errorString := "Incorrect email or password"
-        respondWithError(w, http.StatusUnauthorized, errorString)
+		errorString := "Failure when attempting to check login attempts"
+		respondWithError(w, http.StatusInternalServerError, errorString)
 		return
-    }
-	err = auth.CheckPasswordHash(user.HashedPassword, params.Password)
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return
+	}
+	
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	needsRehash := false
+	if err == nil {
+		needsRehash, err = cfg.passwordHasher.Verify(user.HashedPassword, params.Password)
+	} else if errors.Is(err, sql.ErrNoRows) {
+		// Unknown addresses take as long to reject as wrong passwords.
+		err = cfg.passwordHasher.VerifyDummy(params.Password)
+	}
 	if err != nil {
-		errorString := "Incorrect email or password"
-        respondWithError(w, http.StatusUnauthorized, errorString)
+		if hasherBusy(w, err) {
+			return
+		}
+		cfg.loginFailed(w, r, params.Email)
 		return
     }
+	if needsRehash {
+		cfg.upgradePasswordHash(r.Context(), user, params.Password)
+	}
 	
+	if user.TotpEnabledAt.Valid {
+		// The failure count is kept until the second factor is passed too.
+		cfg.startMFAChallenge(w, r, user)
+		return
+	}
+	err = cfg.loginThrottle.RecordSuccess(r.Context(), params.Email)
+	if err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+	cfg.startSession(w, r, user)
+}
+
+// loginFailed counts a failed login against account and the client's IP
+// address and responds 401, saying how long to wait before trying again.
+func (cfg *apiConfig) loginFailed(w http.ResponseWriter, r *http.Request, account string) {
+	wait, err := cfg.loginThrottle.RecordFailure(r.Context(), account, clientIP(r))
+	if err != nil {
+		errorString := "Failure when attempting to record login attempt"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+	}
+	respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+}
+
+// startSession logs user in, responding with a new access token and the
+// refresh token of a new session.
+func (cfg *apiConfig) startSession(w http.ResponseWriter, r *http.Request, user database.User) {
 	expiresIn := time.Duration(3600) * time.Second
-	token, err := auth.MakeJWT(user.ID, cfg.secret, expiresIn)
+	token, claims, err := cfg.keys.IssueJWT(user.ID, user.Role, expiresIn)
 	if err != nil {
 		errorString := "Failure when attempting to create authentication token"
         respondWithError(w, http.StatusInternalServerError, errorString)
@@ -330,11 +515,16 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	refreshExpiresIn := time.Now().Add(60 * 24 * time.Hour)
 	refreshParams := database.CreateRefreshTokenParams{
-		Token: refreshString,
+		TokenHash: auth.HashRefreshToken(refreshString),
 		UserID: user.ID,
 		ExpiresAt: refreshExpiresIn,
+		FamilyID: uuid.New(),
+		UserAgent: clientUserAgent(r),
+		IpAddress: clientIP(r),
+		AccessTokenID: sql.NullString{String: claims.ID, Valid: true},
+		AccessTokenExpiresAt: sql.NullTime{Time: claims.ExpiresAt.Time, Valid: true},
 	}
-	refreshToken, err := cfg.db.CreateRefreshToken(r.Context(), refreshParams)
+	_, err = cfg.db.CreateRefreshToken(r.Context(), refreshParams)
 	if err != nil {
 		errorString := "Failure when attempting to insert refresh token"
         respondWithError(w, http.StatusInternalServerError, errorString)
@@ -346,52 +536,123 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Role: user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 		Token: token,
-		RefreshToken: refreshToken.Token,
+		RefreshToken: refreshString,
 	}
 	respondWithJSON(w, http.StatusOK, newUser)
 }
 
+// refreshHandler exchanges a refresh token for a new access token and rotates
+// the refresh token. Presenting a token that has already been rotated means it
+// was copied, so the whole family is revoked and both holders must log in again.
 func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
 	authString, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
-    }
-	refreshToken, err := cfg.db.GetRefreshByToken(r.Context(), authString)
+	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Failure when attempting to query for authentication token"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	refreshToken, err := qtx.GetRefreshTokenForUpdate(r.Context(), auth.HashRefreshToken(authString))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			errorString := "Authentication token not found"
-        	respondWithError(w, http.StatusUnauthorized, errorString)
+			respondWithError(w, http.StatusUnauthorized, errorString)
 			return
 		}
 		errorString := "Failure when attempting to query for authentication token"
-        respondWithError(w, http.StatusInternalServerError, errorString)
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if refreshToken.ReplacedBy.Valid {
+		revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			errorString := "Failure when attempting to revoke authentication"
+			respondWithError(w, http.StatusInternalServerError, errorString)
+			return
+		}
+		log.Printf("Refresh token reuse detected for user %s: revoked %d token(s) in family %s", refreshToken.UserID, revoked, refreshToken.FamilyID)
+		respondWithError(w, http.StatusUnauthorized, "Authentication token has already been used")
+		return
+	}
+	if refreshToken.RevokedAt.Valid {
+		errorString := "Authentication token not found"
+		respondWithError(w, http.StatusUnauthorized, errorString)
 		return
 	}
 	if refreshToken.ExpiresAt.Before(time.Now()) {
 		errorString := "Authentication token expired"
-        respondWithError(w, http.StatusUnauthorized, errorString)
+		respondWithError(w, http.StatusUnauthorized, errorString)
 		return
 	}
-	user, err := cfg.db.GetUserByRefreshToken(r.Context(), refreshToken.Token)
+	user, err := qtx.GetUserByID(r.Context(), refreshToken.UserID)
 	if err != nil {
 		errorString := "Failure when attempting to query for user data"
-        respondWithError(w, http.StatusInternalServerError, errorString)
+		respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
 	expiresIn := time.Duration(3600) * time.Second
-	token, err := auth.MakeJWT(user.ID, cfg.secret, expiresIn)
+	token, claims, err := cfg.keys.IssueJWT(user.ID, user.Role, expiresIn)
 	if err != nil {
 		errorString := "Failure when attempting to create authentication token"
-        respondWithError(w, http.StatusInternalServerError, errorString)
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	refreshString, err := auth.MakeRefreshToken()
+	if err != nil {
+		errorString := "Failure when attempting to create refresh token"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	newRefreshToken, err := qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(refreshString),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+		FamilyID:  refreshToken.FamilyID,
+		UserAgent: clientUserAgent(r),
+		IpAddress: clientIP(r),
+		AccessTokenID:        sql.NullString{String: claims.ID, Valid: true},
+		AccessTokenExpiresAt: sql.NullTime{Time: claims.ExpiresAt.Time, Valid: true},
+	})
+	if err != nil {
+		errorString := "Failure when attempting to insert refresh token"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = qtx.MarkRefreshTokenReplaced(r.Context(), database.MarkRefreshTokenReplacedParams{
+		TokenHash:  refreshToken.TokenHash,
+		ReplacedBy: sql.NullString{String: newRefreshToken.TokenHash, Valid: true},
+	})
+	if err != nil {
+		errorString := "Failure when attempting to rotate refresh token"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		errorString := "Failure when attempting to rotate refresh token"
+		respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
 	type returnToken struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	tokenJSON := returnToken{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshString,
 	}
 	respondWithJSON(w, http.StatusOK, tokenJSON)
 }
@@ -402,7 +663,8 @@ func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
         respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
     }
-	revokeStatus, err := cfg.db.CheckRevokeStatus(r.Context(), authString)
+	tokenHash := auth.HashRefreshToken(authString)
+	revokeStatus, err := cfg.db.CheckRevokeStatus(r.Context(), tokenHash)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusUnauthorized, "Invalid or non-existent token")
@@ -412,13 +674,13 @@ func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
-	if revokeStatus.Valid {
+	if revokeStatus.RevokedAt.Valid {
 		respondWithError(w, http.StatusConflict, "Authentication has already been revoked")
 		return
 	}
 	revokeParams := database.RevokeRefreshParams{
 		UpdatedAt: time.Now(),
-		Token:	   authString,
+		TokenHash: tokenHash,
 	}
 	err = cfg.db.RevokeRefresh(r.Context(), revokeParams)
 	if err != nil {
@@ -426,20 +688,17 @@ func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
+	err = cfg.revokeSessionAccessTokens(r.Context(), revokeStatus.UserID, revokeStatus.FamilyID)
+	if err != nil {
+		errorString := "Something went wrong when trying to revoke authentication"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) updateUserPassHandler(w http.ResponseWriter, r *http.Request) {
-	authString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-    }
-	userID, err := auth.ValidateJWT(authString, cfg.secret)
-	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-    }
+	userID := currentUserID(r)
 
 	type parameters struct {
 		Password string `json:"password"`
@@ -451,78 +710,171 @@ func (cfg *apiConfig) updateUserPassHandler(w http.ResponseWriter, r *http.Reque
 	}
     decoder := json.NewDecoder(r.Body)
     params := parameters{}
-    err = decoder.Decode(&params)
+    err := decoder.Decode(&params)
     if err != nil {
 		errorString := "Something went wrong"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
     }
+	if !validEmail(params.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+	previous, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
 
-	hash, err := auth.HashPassword(params.Password)
+	hash, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
+		if hasherBusy(w, err) {
+			return
+		}
 		errorString := "Something went wrong when working with password"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Something went wrong when attempting to update user's email and password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 	userParams := database.UpdateUserPassParams{
 		ID:		userID,
 		Email:	params.Email,
 		HashedPassword: hash,
 	}
-	err = cfg.db.UpdateUserPass(r.Context(), userParams)
+	err = qtx.UpdateUserPass(r.Context(), userParams)
 	if err != nil {
 		errorString := "Something went wrong when attempting to update user's email and password"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
-	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	user, err := qtx.GetUserByID(r.Context(), userID)
 	if err != nil {
 		errorString := "Something went wrong when attempting to retrieve user's information"
         respondWithError(w, http.StatusInternalServerError, errorString)
 		return
 	}
+	// A new address is only saved together with the token that verifies it,
+	// so it cannot be left unverified with no way to verify it.
+	var verificationToken string
+	if user.Email != previous.Email {
+		verificationToken, err = createEmailVerification(r.Context(), qtx, user.ID, user.Email)
+	}
+	// Like a reset, a new password logs out every session and API key that
+	// may have been opened with the old one.
+	if err == nil {
+		_, err = qtx.RevokeAllSessions(r.Context(), userID)
+	}
+	if err == nil {
+		err = qtx.RevokeAllAPIKeys(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Something went wrong when attempting to update user's email and password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.revokeAccessTokens(r.Context(), userID)
+	if err != nil {
+		errorString := "Something went wrong when attempting to revoke existing access tokens"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if verificationToken != "" {
+		cfg.sendVerificationEmail(r.Context(), user.Email, verificationToken)
+	}
 	newUser := User{
 		ID:	user.ID,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Role: user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
 	respondWithJSON(w, http.StatusOK, newUser)
 }
 
-func (cfg *apiConfig) deleteChirpsHandler(w http.ResponseWriter, r *http.Request){
-    authString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-    }
-	userID, err := auth.ValidateJWT(authString, cfg.secret)
-	if err != nil {
-        respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-    }
+// ownedChirp loads the chirp named by the chirpID path value and checks that
+// userID wrote it. On failure it has already written the response.
+func (cfg *apiConfig) ownedChirp(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Chirp, bool) {
 	chirpIDStr := r.PathValue("chirpID")
 	chirpID, err := uuid.Parse(chirpIDStr)
     if err != nil {
         respondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
-        return
+        return database.Chirp{}, false
     }
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	chirp, err := cfg.db.GetChirp(r.Context(), database.GetChirpParams{
+		ID:			chirpID,
+		ViewerID:	uuid.NullUUID{UUID: userID, Valid: true},
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			errorString := "Chirp not found"
         	respondWithError(w, http.StatusNotFound, errorString)
-			return
+			return database.Chirp{}, false
 		}
 		errorString := "Error when attempting to find chirp"
         respondWithError(w, http.StatusInternalServerError, errorString)
-		return
+		return database.Chirp{}, false
     }
 	if chirp.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "User does not own this chirp")
+		return database.Chirp{}, false
+	}
+	return chirp, true
+}
+
+func (cfg *apiConfig) deleteChirpsHandler(w http.ResponseWriter, r *http.Request){
+	userID := currentUserID(r)
+	chirp, ok := cfg.ownedChirp(w, r, userID)
+	if !ok {
 		return
 	}
-	err = cfg.db.DeleteChirp(r.Context(), chirpID)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Error when attempting to delete chirp"
+        respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	err = qtx.LockChirp(r.Context(), chirp.ID)
+	// Replies outlive the chirp they answer, so a chirp with replies is left
+	// behind as a tombstone instead of being removed. Nothing the author
+	// wrote is kept with it.
+	var hasReplies bool
+	if err == nil {
+		hasReplies, err = qtx.ChirpHasReplies(r.Context(), uuid.NullUUID{UUID: chirp.ID, Valid: true})
+	}
+	if err == nil && hasReplies {
+		err = qtx.TombstoneChirp(r.Context(), chirp.ID)
+		if err == nil {
+			err = qtx.DeleteChirpRevisions(r.Context(), chirp.ID)
+		}
+		if err == nil {
+			err = qtx.DeleteChirpTags(r.Context(), chirp.ID)
+		}
+		if err == nil {
+			err = qtx.DeleteChirpMentions(r.Context(), chirp.ID)
+		}
+	} else if err == nil {
+		err = qtx.DeleteChirp(r.Context(), chirp.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		errorString := "Error when attempting to delete chirp"
         respondWithError(w, http.StatusInternalServerError, errorString)
@@ -542,27 +894,112 @@ func main() {
         log.Fatal("Error accessing database")
     }
 	dbQueries := database.New(db)
+	if len(os.Args) > 1 && os.Args[1] == "promote" {
+		err = runPromote(context.Background(), dbQueries, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	moderationChain, err := loadModerationChain(context.Background(), dbQueries)
+	if err != nil {
+		log.Fatalf("Error loading moderation rules: %v", err)
+	}
+	keys, err := loadKeyManager()
+	if err != nil {
+		log.Fatalf("Error loading signing keys: %v", err)
+	}
+	mail, err := loadMailer()
+	if err != nil {
+		log.Fatalf("Error setting up mail: %v", err)
+	}
+	loginThrottle, err := loadLoginThrottle(dbQueries)
+	if err != nil {
+		log.Fatalf("Error setting up login throttling: %v", err)
+	}
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy: %v", err)
+	}
+	passwordHasher, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	oidcProviders, err := loadOIDCProviders(context.Background(), publicURL)
+	if err != nil {
+		log.Fatalf("Error setting up login providers: %v", err)
+	}
 	config := &apiConfig{
 		db: dbQueries,
+		dbConn: db,
 		platform: os.Getenv("PLATFORM"),
-		secret:	os.Getenv("JWT_SECRET"),
-	}
+		keys: keys,
+		mailer: mail,
+		publicURL: publicURL,
+		forgotPasswordLimiter: ratelimit.New(5, 15*time.Minute),
+		loginThrottle: loginThrottle,
+		passwordPolicy: passwordPolicy,
+		passwordHasher: passwordHasher,
+		oidcProviders: oidcProviders,
+		moderation: moderationChain,
+		revocations: auth.NewCachedRevocationStore(pgRevocationStore{db: dbQueries}, revocationCacheTTL),
+	}
+	authMiddleware := auth.NewMiddleware(newTokenValidator(config.keys), config.revocations).AcceptAPIKeys(pgAPIKeyStore{db: dbQueries})
 	server := http.NewServeMux()
 	server.HandleFunc("GET /api/healthz", healthCheckHandler)
+	server.HandleFunc("GET /.well-known/jwks.json", config.jwksHandler)
 	dir := http.Dir(".")
 	fServer := http.FileServer(dir)
 	server.Handle("/app/", config.middlewareMetricsInc(http.StripPrefix("/app", fServer)))
-	server.HandleFunc("GET /admin/metrics", config.metricCountHandler)
-	server.HandleFunc("GET /api/chirps", config.getChirpsHandler)
-	server.HandleFunc("GET /api/chirps/{chirpID}", config.getChirpByIDHandler)
-	server.HandleFunc("POST /admin/reset", config.adminResetHandler)
+	server.Handle("GET /admin/metrics", authMiddleware.RequireRole(http.HandlerFunc(config.metricCountHandler), auth.RoleAdmin))
+	server.Handle("GET /api/chirps", authMiddleware.OptionalScope(http.HandlerFunc(config.getChirpsHandler), auth.ScopeChirpsRead))
+	server.Handle("GET /api/chirps/{chirpID}", authMiddleware.OptionalScope(http.HandlerFunc(config.getChirpByIDHandler), auth.ScopeChirpsRead))
+	server.Handle("GET /api/chirps/search", authMiddleware.OptionalScope(http.HandlerFunc(config.searchChirpsHandler), auth.ScopeChirpsRead))
+	server.Handle("POST /admin/reset", authMiddleware.RequireRole(http.HandlerFunc(config.adminResetHandler), auth.RoleAdmin))
 	server.HandleFunc("POST /api/users", config.createUserHandler)
-	server.HandleFunc("POST /api/chirps", config.chirpsHandler)
+	server.HandleFunc("POST /api/users/verify", config.verifyEmailHandler)
+	server.Handle("POST /api/users/verify/resend", authMiddleware.RequireAuth(http.HandlerFunc(config.resendVerificationHandler)))
+	server.Handle("POST /api/chirps", authMiddleware.RequireScope(http.HandlerFunc(config.chirpsHandler), auth.ScopeChirpsWrite))
 	server.HandleFunc("POST /api/login", config.loginHandler)
+	server.HandleFunc("POST /api/login/mfa", config.loginMFAHandler)
+	server.HandleFunc("GET /api/auth/{provider}/login", config.oidcLoginHandler)
+	server.HandleFunc("GET /api/auth/{provider}/callback", config.oidcCallbackHandler)
+	server.Handle("POST /api/users/me/2fa/enroll", authMiddleware.RequireAuth(http.HandlerFunc(config.enrollTOTPHandler)))
+	server.Handle("POST /api/users/me/2fa/confirm", authMiddleware.RequireAuth(http.HandlerFunc(config.confirmTOTPHandler)))
+	server.Handle("DELETE /api/users/me/2fa", authMiddleware.RequireAuth(http.HandlerFunc(config.disableTOTPHandler)))
+	server.HandleFunc("POST /api/password/forgot", config.forgotPasswordHandler)
+	server.HandleFunc("POST /api/password/reset", config.resetPasswordHandler)
 	server.HandleFunc("POST /api/refresh", config.refreshHandler)
 	server.HandleFunc("POST /api/revoke", config.revokeHandler)
-	server.HandleFunc("PUT /api/users", config.updateUserPassHandler)
-	server.HandleFunc("DELETE /api/chirps/{chirpID}", config.deleteChirpsHandler)
+	server.Handle("PUT /api/users", authMiddleware.RequireAuth(http.HandlerFunc(config.updateUserPassHandler)))
+	server.Handle("DELETE /api/chirps/{chirpID}", authMiddleware.RequireScope(http.HandlerFunc(config.deleteChirpsHandler), auth.ScopeChirpsWrite))
+	server.Handle("PUT /api/chirps/{chirpID}", authMiddleware.RequireScope(http.HandlerFunc(config.editChirpHandler), auth.ScopeChirpsWrite))
+	server.Handle("GET /api/chirps/{chirpID}/revisions", authMiddleware.RequireScope(http.HandlerFunc(config.chirpRevisionsHandler), auth.ScopeChirpsRead))
+	server.Handle("GET /api/chirps/{chirpID}/thread", authMiddleware.OptionalScope(http.HandlerFunc(config.chirpThreadHandler), auth.ScopeChirpsRead))
+	server.Handle("POST /api/chirps/{chirpID}/likes", authMiddleware.RequireAuth(http.HandlerFunc(config.likeChirpHandler)))
+	server.Handle("DELETE /api/chirps/{chirpID}/likes", authMiddleware.RequireAuth(http.HandlerFunc(config.unlikeChirpHandler)))
+	server.Handle("POST /api/chirps/{chirpID}/report", authMiddleware.RequireAuth(http.HandlerFunc(config.reportChirpHandler)))
+	server.Handle("GET /admin/reports", authMiddleware.RequireRole(http.HandlerFunc(config.adminListReportsHandler), auth.RoleModerator, auth.RoleAdmin))
+	server.Handle("POST /admin/reports/{reportID}/resolve", authMiddleware.RequireRole(http.HandlerFunc(config.adminResolveReportHandler), auth.RoleModerator, auth.RoleAdmin))
+	server.Handle("POST /admin/chirps/{chirpID}/hide", authMiddleware.RequireRole(http.HandlerFunc(config.adminHideChirpHandler), auth.RoleModerator, auth.RoleAdmin))
+	server.Handle("POST /admin/chirps/{chirpID}/restore", authMiddleware.RequireRole(http.HandlerFunc(config.adminRestoreChirpHandler), auth.RoleModerator, auth.RoleAdmin))
+	server.Handle("POST /admin/users/{userID}/unlock", authMiddleware.RequireRole(http.HandlerFunc(config.adminUnlockUserHandler), auth.RoleAdmin))
+	server.Handle("PUT /admin/users/{userID}/role", authMiddleware.RequireRole(http.HandlerFunc(config.adminSetRoleHandler), auth.RoleAdmin))
+	server.Handle("POST /api/users/{userID}/follow", authMiddleware.RequireAuth(http.HandlerFunc(config.followHandler)))
+	server.Handle("DELETE /api/users/{userID}/follow", authMiddleware.RequireAuth(http.HandlerFunc(config.unfollowHandler)))
+	server.HandleFunc("GET /api/users/{userID}/followers", config.followersHandler)
+	server.HandleFunc("GET /api/users/{userID}/following", config.followingHandler)
+	server.Handle("GET /api/timeline", authMiddleware.RequireScope(http.HandlerFunc(config.timelineHandler), auth.ScopeChirpsRead))
+	server.HandleFunc("GET /api/tags/trending", config.trendingTagsHandler)
+	server.Handle("GET /api/tags/{tag}/chirps", authMiddleware.OptionalScope(http.HandlerFunc(config.tagChirpsHandler), auth.ScopeChirpsRead))
+	server.Handle("POST /api/keys", authMiddleware.RequireAuth(http.HandlerFunc(config.createAPIKeyHandler)))
+	server.Handle("GET /api/keys", authMiddleware.RequireAuth(http.HandlerFunc(config.listAPIKeysHandler)))
+	server.Handle("DELETE /api/keys/{keyID}", authMiddleware.RequireAuth(http.HandlerFunc(config.revokeAPIKeyHandler)))
+	server.Handle("GET /api/sessions", authMiddleware.RequireAuth(http.HandlerFunc(config.listSessionsHandler)))
+	server.Handle("DELETE /api/sessions/{sessionID}", authMiddleware.RequireAuth(http.HandlerFunc(config.revokeSessionHandler)))
+	server.Handle("DELETE /api/sessions", authMiddleware.RequireAuth(http.HandlerFunc(config.revokeAllSessionsHandler)))
+	server.Handle("GET /api/users/me/mentions", authMiddleware.RequireScope(http.HandlerFunc(config.mentionsHandler), auth.ScopeChirpsRead))
 	s := &http.Server{
 		Addr:	":8080",
 		Handler: server,
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+	"github.com/Rota-of-light/HTTPServer/internal/moderation"
+)
+
+const maxChirpLength = 140
+
+// loadModerationChain builds the filters every chirp body goes through. The
+// word list comes from MODERATION_WORDS_FILE when set, otherwise from the
+// moderation_words table, and falls back to the built-in list when that is
+// empty. MODERATION_RULES_FILE adds regex rules, and the spam heuristics are
+// tuned with MODERATION_MAX_LINKS and MODERATION_BLOCKED_DOMAINS.
+func loadModerationChain(ctx context.Context, db *database.Queries) (moderation.Chain, error) {
+	var words []moderation.WordRule
+	if path := os.Getenv("MODERATION_WORDS_FILE"); path != "" {
+		var err error
+		words, err = moderation.LoadWordListFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading word list: %w", err)
+		}
+	} else {
+		rows, err := db.ListModerationWords(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading word list: %w", err)
+		}
+		for _, row := range rows {
+			action, err := moderation.ParseAction(row.Action)
+			if err != nil {
+				return nil, fmt.Errorf("loading word list: %w", err)
+			}
+			words = append(words, moderation.WordRule{Word: row.Word, Action: action})
+		}
+	}
+	if len(words) == 0 {
+		words = moderation.DefaultWords
+	}
+	chain := moderation.Chain{moderation.NewWordList(words)}
+
+	if path := os.Getenv("MODERATION_RULES_FILE"); path != "" {
+		rules, err := moderation.LoadRegexRulesFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading regex rules: %w", err)
+		}
+		chain = append(chain, &moderation.RegexFilter{Rules: rules})
+	}
+
+	spam := &moderation.SpamFilter{
+		MaxLinks:        3,
+		MaxRepeatedRune: 20,
+		Action:          moderation.ActionFlag,
+	}
+	if maxLinks := os.Getenv("MODERATION_MAX_LINKS"); maxLinks != "" {
+		n, err := strconv.Atoi(maxLinks)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MODERATION_MAX_LINKS: %w", err)
+		}
+		spam.MaxLinks = n
+	}
+	for _, domain := range strings.Split(os.Getenv("MODERATION_BLOCKED_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			spam.BlockedDomains = append(spam.BlockedDomains, strings.ToLower(domain))
+		}
+	}
+	chain = append(chain, spam)
+	return chain, nil
+}
+
+// moderateChirpBody enforces the length limit on a chirp and runs it through
+// the moderation chain. The returned error is safe to show to the author.
+func (cfg *apiConfig) moderateChirpBody(body string) (moderation.Result, error) {
+	if len(body) > maxChirpLength {
+		return moderation.Result{}, errors.New("Chirp is too long")
+	}
+	res := cfg.moderation.Run(body)
+	if res.Rejected {
+		return res, fmt.Errorf("Chirp rejected: %s", strings.Join(res.Reasons, "; "))
+	}
+	return res, nil
+}
+
+// recordChirpFlags files a report without a reporter for every reason
+// moderation flagged a chirp, which puts it in the admin review queue. q
+// should be bound to the transaction that wrote the chirp.
+func recordChirpFlags(ctx context.Context, q *database.Queries, chirpID uuid.UUID, res moderation.Result) error {
+	if !res.Flagged {
+		return nil
+	}
+	for _, reason := range res.Reasons {
+		_, err := q.CreateChirpReport(ctx, database.CreateChirpReportParams{
+			ChirpID: chirpID,
+			Reason:  reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+	"github.com/Rota-of-light/HTTPServer/internal/oidc"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute
+	oidcStateCookie = "chirpy_oidc_state"
+)
+
+var (
+	errIdentityNoEmail  = errors.New("provider did not share an email address")
+	errIdentityConflict = errors.New("an account with this email address already exists")
+)
+
+// loadOIDCProviders sets up the providers named in OIDC_PROVIDERS, a comma
+// separated list such as "google,gitlab". Each needs OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET, and should be given
+// <PUBLIC_URL>/api/auth/<name>/callback as its redirect URI.
+func loadOIDCProviders(ctx context.Context, publicURL string) (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if publicURL == "" {
+			return nil, errors.New("PUBLIC_URL must be set to use OIDC_PROVIDERS")
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		issuer := os.Getenv(prefix + "ISSUER")
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+		if issuer == "" || clientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		redirectURL := publicURL + "/api/auth/" + name + "/callback"
+		provider, err := oidc.Discover(ctx, nil, name, issuer, clientID, os.Getenv(prefix+"CLIENT_SECRET"), redirectURL)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = provider
+	}
+	return providers, nil
+}
+
+// oidcLoginHandler starts logging in with an external provider by sending
+// the user there. The state is also set in a cookie, so that the callback
+// only completes a login for the browser that started it.
+func (cfg *apiConfig) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+	state, err := oidc.RandomString()
+	var nonce, verifier string
+	if err == nil {
+		nonce, err = oidc.RandomString()
+	}
+	if err == nil {
+		verifier, err = oidc.RandomString()
+	}
+	if err != nil {
+		errorString := "Failure when attempting to start login"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.db.DeleteExpiredOIDCLoginStates(r.Context())
+	if err == nil {
+		err = cfg.db.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+			StateHash:    auth.HashOpaqueToken(state),
+			Provider:     provider.Name,
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ExpiresAt:    time.Now().Add(oidcLoginTTL),
+		})
+	}
+	if err != nil {
+		errorString := "Failure when attempting to start login"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	http.SetCookie(w, cfg.oidcStateCookie(provider.Name, state, int(oidcLoginTTL.Seconds())))
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+func (cfg *apiConfig) oidcStateCookie(provider, state string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/" + provider,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.publicURL, "https://"),
+		// Lax still sends the cookie on the provider's redirect back to us.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oidcCallbackHandler finishes an external login. It responds like
+// loginHandler, including asking for a second factor when one is enabled.
+func (cfg *apiConfig) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		respondWithError(w, http.StatusUnauthorized, "Login was cancelled or refused by the provider")
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Login state does not match, start again")
+		return
+	}
+	http.SetCookie(w, cfg.oidcStateCookie(provider.Name, "", -1))
+
+	login, err := cfg.db.ConsumeOIDCLoginState(r.Context(), database.ConsumeOIDCLoginStateParams{
+		StateHash: auth.HashOpaqueToken(state),
+		Provider:  provider.Name,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Login state is invalid or has expired, start again")
+			return
+		}
+		errorString := "Failure when attempting to check login state"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		log.Printf("Error exchanging %s authorization code: %v", provider.Name, err)
+		if errors.Is(err, oidc.ErrTokenExchange) {
+			respondWithError(w, http.StatusUnauthorized, "Login was refused by the provider")
+			return
+		}
+		respondWithError(w, http.StatusBadGateway, "Could not reach the login provider")
+		return
+	}
+	identity, err := provider.Verify(r.Context(), rawIDToken, login.Nonce)
+	if err != nil {
+		log.Printf("Error verifying %s id token: %v", provider.Name, err)
+		respondWithError(w, http.StatusUnauthorized, "Could not verify identity from the login provider")
+		return
+	}
+	user, err := cfg.userForIdentity(r.Context(), provider.Name, identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errIdentityNoEmail):
+			respondWithError(w, http.StatusBadRequest, "The login provider did not share a usable email address")
+		case errors.Is(err, errIdentityConflict):
+			respondWithError(w, http.StatusConflict, "An account with this email address already exists, log in with your password")
+		default:
+			errorString := "Something went wrong when attempting to log in"
+			respondWithError(w, http.StatusInternalServerError, errorString)
+		}
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		cfg.startMFAChallenge(w, r, user)
+		return
+	}
+	cfg.startSession(w, r, user)
+}
+
+// userForIdentity returns the user linked to an external identity, linking
+// or creating one on first login. An existing account is only linked when
+// both the provider and we have verified its email address; otherwise
+// whoever registered the address first could take over the other's login.
+// New accounts have no password until one is set through a password reset.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, provider string, identity *oidc.IDToken) (database.User, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		err = qtx.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			Provider: provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		return user, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if !validEmail(identity.Email) {
+		return database.User{}, errIdentityNoEmail
+	}
+	user, err = qtx.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified || !user.EmailVerifiedAt.Valid {
+			return database.User{}, errIdentityConflict
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = qtx.CreateExternalUser(ctx, database.CreateExternalUserParams{
+			Email:           identity.Email,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: identity.EmailVerified},
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+	default:
+		return database.User{}, err
+	}
+	err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+// loadPasswordHasher hashes new passwords with Argon2id by default.
+// PASSWORD_HASH_ALGORITHM selects "argon2id" or "bcrypt", and ARGON2_MEMORY_KIB,
+// ARGON2_TIME, ARGON2_PARALLELISM and BCRYPT_COST override the costs. Raising
+// them upgrades existing hashes as their users next log in.
+// PASSWORD_HASH_CONCURRENCY caps how many hashes run at once, one per CPU by
+// default; lower it if that many times ARGON2_MEMORY_KIB does not fit.
+func loadPasswordHasher() (*auth.PasswordHasher, error) {
+	hasher := auth.DefaultPasswordHasher()
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		if algorithm != auth.AlgorithmArgon2id && algorithm != auth.AlgorithmBcrypt {
+			return nil, fmt.Errorf("unknown PASSWORD_HASH_ALGORITHM %q", algorithm)
+		}
+		hasher.Algorithm = algorithm
+	}
+	settings := []struct {
+		env  string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { hasher.Argon2.Memory = uint32(v) }},
+		{"ARGON2_TIME", 32, func(v uint64) { hasher.Argon2.Time = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { hasher.Argon2.Parallelism = uint8(v) }},
+		{"BCRYPT_COST", 8, func(v uint64) { hasher.BcryptCost = int(v) }},
+		{"PASSWORD_HASH_CONCURRENCY", 16, func(v uint64) { hasher.MaxConcurrent = int(v) }},
+	}
+	for _, setting := range settings {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || v == 0 {
+			return nil, fmt.Errorf("invalid %s %q", setting.env, value)
+		}
+		setting.set(v)
+	}
+	return hasher, nil
+}
+
+// hasherBusy responds 503 when err is the hasher turning work away, and
+// reports whether it did.
+func hasherBusy(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, auth.ErrHasherBusy) {
+		return false
+	}
+	setRetryAfter(w, time.Second)
+	respondWithError(w, http.StatusServiceUnavailable, "Server is busy, try again shortly")
+	return true
+}
+
+// upgradePasswordHash replaces user's stored hash with one using the current
+// algorithm and costs, now that the plaintext password is at hand. Failing
+// is harmless, so errors are only logged.
+func (cfg *apiConfig) upgradePasswordHash(ctx context.Context, user database.User, password string) {
+	hash, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %v", err)
+		return
+	}
+	// Matching on the old hash leaves a password changed meanwhile alone.
+	err = cfg.db.UpgradePasswordHash(ctx, database.UpgradePasswordHashParams{
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+		NewHash: hash,
+	})
+	if err != nil {
+		log.Printf("Error storing rehashed password: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+)
+
+// loadPasswordPolicy uses the default policy, also checking passwords
+// against the breach corpus in PWNED_PASSWORDS_DIR when it is set.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy()
+	if dir := os.Getenv("PWNED_PASSWORDS_DIR"); dir != "" {
+		corpus, err := auth.NewBreachCorpus(dir)
+		if err != nil {
+			return auth.PasswordPolicy{}, err
+		}
+		policy.Breaches = corpus
+	}
+	return policy, nil
+}
+
+// checkPassword applies the password policy, responding 400 with every
+// violation when password is not acceptable.
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password string) bool {
+	violations, err := cfg.passwordPolicy.Check(password)
+	if err != nil {
+		errorString := "Something went wrong when working with password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+	type policyError struct {
+		Error      string                   `json:"error"`
+		Violations []auth.PasswordViolation `json:"violations"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, policyError{
+		Error:      "Password does not meet the password policy",
+		Violations: violations,
+	})
+	return false
+}
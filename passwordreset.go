@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+	"github.com/Rota-of-light/HTTPServer/internal/mailer"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	// At most this many reset emails go to one account per hour, however
+	// many addresses the requests come from.
+	maxPasswordResetsPerHour = 3
+)
+
+// forgotPasswordHandler emails a reset token. It answers the same way whether
+// or not the address belongs to an account, and does the work after
+// responding so that timing does not give it away either.
+func (cfg *apiConfig) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if ok, retryAfter := cfg.forgotPasswordLimiter.Allow(clientIP(r)); !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Too many password reset requests")
+		return
+	}
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	email := strings.TrimSpace(params.Email)
+	if !validEmail(email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	go cfg.sendPasswordReset(context.WithoutCancel(r.Context()), email)
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If that address belongs to an account, a password reset email is on its way",
+	})
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+		return
+	}
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		log.Printf("Error creating password reset token: %v", err)
+		return
+	}
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error storing password reset token: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	var created int64
+	err = qtx.LockUserForPasswordReset(ctx, user.ID)
+	if err == nil {
+		created, err = qtx.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashOpaqueToken(token),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(passwordResetTTL),
+			Since:     time.Now().Add(-time.Hour),
+			MaxRecent: maxPasswordResetsPerHour,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error storing password reset token: %v", err)
+		return
+	}
+	if created == 0 {
+		return
+	}
+	var body strings.Builder
+	body.WriteString("Someone asked to reset the password of your Chirpy account.\n\n")
+	if cfg.publicURL != "" {
+		fmt.Fprintf(&body, "Choose a new password by visiting %s/app/reset-password?token=%s\n\n", cfg.publicURL, token)
+	}
+	fmt.Fprintf(&body, "Your reset token is: %s\n\n", token)
+	fmt.Fprintf(&body, "It expires in %s. If it was not you, you can ignore this email.\n", passwordResetTTL)
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    body.String(),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email: %v", err)
+	}
+}
+
+// resetPasswordHandler sets a new password using a token from
+// forgotPasswordHandler and logs the account out everywhere, revoking its
+// API keys as well.
+func (cfg *apiConfig) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+	hash, err := cfg.passwordHasher.Hash(params.Password)
+	if err != nil {
+		if hasherBusy(w, err) {
+			return
+		}
+		errorString := "Something went wrong when working with password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Something went wrong when attempting to reset password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userID, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashOpaqueToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Reset token is invalid or has expired")
+			return
+		}
+		errorString := "Something went wrong when attempting to reset password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = qtx.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hash,
+	})
+	if err == nil {
+		err = qtx.InvalidatePasswordResetTokens(r.Context(), userID)
+	}
+	if err == nil {
+		_, err = qtx.RevokeAllSessions(r.Context(), userID)
+	}
+	if err == nil {
+		// Keys made by whoever had the account must not outlive the reset.
+		err = qtx.RevokeAllAPIKeys(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Something went wrong when attempting to reset password"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.revokeAccessTokens(r.Context(), userID)
+	if err != nil {
+		errorString := "Something went wrong when attempting to revoke existing access tokens"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
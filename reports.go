@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+const maxReportReasonLength = 500
+
+type ChirpReport struct {
+	ID         uuid.UUID  `json:"id"`
+	ChirpID    uuid.UUID  `json:"chirp_id"`
+	ReporterID *uuid.UUID `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy *uuid.UUID `json:"resolved_by"`
+	Resolution *string    `json:"resolution"`
+}
+
+type ReportedChirp struct {
+	ChirpReport
+	ChirpBody   string    `json:"chirp_body"`
+	ChirpUserID uuid.UUID `json:"chirp_user_id"`
+	ChirpHidden bool      `json:"chirp_hidden"`
+}
+
+// chirpViewer is who chirps are being shown to. Hidden chirps are only
+// visible to their author and to moderators and admins.
+type chirpViewer struct {
+	ID          uuid.NullUUID
+	IsModerator bool
+}
+
+// optionalViewer identifies the caller when auth.Middleware authenticated
+// the request. Anyone else is treated as an anonymous viewer.
+func optionalViewer(r *http.Request) chirpViewer {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return chirpViewer{}
+	}
+	return chirpViewer{
+		ID:          uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		IsModerator: principal.HasRole(auth.RoleModerator, auth.RoleAdmin),
+	}
+}
+
+func chirpReportFromDB(report database.ChirpReport) ChirpReport {
+	res := ChirpReport{
+		ID:        report.ID,
+		ChirpID:   report.ChirpID,
+		Reason:    report.Reason,
+		Status:    report.Status,
+		CreatedAt: report.CreatedAt,
+	}
+	if report.ReporterID.Valid {
+		res.ReporterID = &report.ReporterID.UUID
+	}
+	if report.ResolvedAt.Valid {
+		res.ResolvedAt = &report.ResolvedAt.Time
+	}
+	if report.ResolvedBy.Valid {
+		res.ResolvedBy = &report.ResolvedBy.UUID
+	}
+	if report.Resolution.Valid {
+		res.Resolution = &report.Resolution.String
+	}
+	return res
+}
+
+func (cfg *apiConfig) reportChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	chirpID, ok := cfg.chirpTarget(w, r, userID)
+	if !ok {
+		return
+	}
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+	if len(params.Reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, "Reason is too long")
+		return
+	}
+	report, err := cfg.db.CreateChirpReport(r.Context(), database.CreateChirpReportParams{
+		ChirpID:    chirpID,
+		ReporterID: uuid.NullUUID{UUID: userID, Valid: true},
+		Reason:     params.Reason,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusConflict, "You have already reported this chirp")
+			return
+		}
+		errorString := "Error when attempting to report chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, chirpReportFromDB(report))
+}
+
+func (cfg *apiConfig) adminListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if status != "open" && status != "resolved" {
+		respondWithError(w, http.StatusBadRequest, "status must be 'open' or 'resolved'")
+		return
+	}
+	rows, err := cfg.db.ListChirpReports(r.Context(), status)
+	if err != nil {
+		errorString := "Error when attempting to retrive reports"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	reports := make([]ReportedChirp, len(rows))
+	for i, row := range rows {
+		reports[i] = ReportedChirp{
+			ChirpReport: chirpReportFromDB(database.ChirpReport{
+				ID:         row.ID,
+				ChirpID:    row.ChirpID,
+				ReporterID: row.ReporterID,
+				Reason:     row.Reason,
+				Status:     row.Status,
+				CreatedAt:  row.CreatedAt,
+				ResolvedAt: row.ResolvedAt,
+				ResolvedBy: row.ResolvedBy,
+				Resolution: row.Resolution,
+			}),
+			ChirpBody:   row.ChirpBody,
+			ChirpUserID: row.ChirpUserID,
+			ChirpHidden: row.ChirpHiddenAt.Valid,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) adminResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := currentUserID(r)
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID format")
+		return
+	}
+	type parameters struct {
+		Resolution string `json:"resolution"`
+	}
+	params := parameters{}
+	if r.Body != nil {
+		err = json.NewDecoder(r.Body).Decode(&params)
+		if err != nil && !errors.Is(err, io.EOF) {
+			respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+			return
+		}
+	}
+	resolution := sql.NullString{}
+	if params.Resolution = strings.TrimSpace(params.Resolution); params.Resolution != "" {
+		resolution = sql.NullString{String: params.Resolution, Valid: true}
+	}
+	report, err := cfg.db.ResolveChirpReport(r.Context(), database.ResolveChirpReportParams{
+		ID:         reportID,
+		ResolvedBy: uuid.NullUUID{UUID: adminID, Valid: true},
+		Resolution: resolution,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Open report not found")
+			return
+		}
+		errorString := "Error when attempting to resolve report"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirpReportFromDB(report))
+}
+
+func (cfg *apiConfig) adminHideChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpHidden(w, r, true)
+}
+
+func (cfg *apiConfig) adminRestoreChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpHidden(w, r, false)
+}
+
+func (cfg *apiConfig) setChirpHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
+		return
+	}
+	chirp, err := cfg.db.SetChirpHidden(r.Context(), database.SetChirpHiddenParams{
+		Hidden: hidden,
+		ID:     chirpID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		errorString := "Error when attempting to update chirp visibility"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirpFromDB(chirp))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// editChirpHandler replaces the body of a chirp owned by the caller. The body
+// being replaced is read under a row lock and kept in chirp_revisions in the
+// same transaction, so concurrent edits each keep the body they replaced.
+func (cfg *apiConfig) editChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	owned, ok := cfg.ownedChirp(w, r, userID)
+	if !ok {
+		return
+	}
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		errorString := "Something went wrong when decoding request"
+		respondWithError(w, http.StatusBadRequest, errorString)
+		return
+	}
+	moderated, err := cfg.moderateChirpBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Error when attempting to update chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	err = qtx.LockChirp(r.Context(), owned.ID)
+	var chirp database.Chirp
+	if err == nil {
+		chirp, err = qtx.GetChirp(r.Context(), database.GetChirpParams{
+			ID:       owned.ID,
+			ViewerID: uuid.NullUUID{UUID: userID, Valid: true},
+		})
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		errorString := "Error when attempting to find chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if moderated.Text == chirp.Body {
+		respondWithJSON(w, http.StatusOK, chirpFromDB(chirp))
+		return
+	}
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+		CreatedAt: chirp.UpdatedAt,
+	})
+	if err != nil {
+		errorString := "Error when attempting to store chirp revision"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	updated, err := qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirp.ID,
+		Body: moderated.Text,
+	})
+	if err != nil {
+		errorString := "Error when attempting to update chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = qtx.DeleteChirpTags(r.Context(), updated.ID)
+	if err == nil {
+		err = qtx.DeleteChirpMentions(r.Context(), updated.ID)
+	}
+	if err == nil {
+		err = storeChirpEntities(r.Context(), qtx, updated)
+	}
+	if err != nil {
+		errorString := "Error when attempting to store chirp tags and mentions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = recordChirpFlags(r.Context(), qtx, updated.ID, moderated)
+	if err != nil {
+		errorString := "Error when attempting to flag chirp for review"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		errorString := "Error when attempting to update chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirpFromDB(updated))
+}
+
+// chirpRevisionsHandler lists every earlier body of a chirp, oldest first.
+// Edits can take back something the author did not mean to post, so only
+// the author and moderators get to see what came before.
+func (cfg *apiConfig) chirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
+		return
+	}
+	viewer := optionalViewer(r)
+	chirp, err := cfg.db.GetChirp(r.Context(), database.GetChirpParams{
+		ID:                chirpID,
+		ViewerID:          viewer.ID,
+		ViewerIsModerator: viewer.IsModerator,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		errorString := "Error when attempting to retrive chirp"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if chirp.UserID != viewer.ID.UUID && !viewer.IsModerator {
+		respondWithError(w, http.StatusForbidden, "Only the author and moderators can see earlier versions of a chirp")
+		return
+	}
+	dbRevisions, err := cfg.db.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		errorString := "Error when attempting to retrive chirp revisions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	revisions := make([]ChirpRevision, len(dbRevisions))
+	for i, revision := range dbRevisions {
+		revisions[i] = ChirpRevision{
+			ID:         revision.ID,
+			ChirpID:    revision.ChirpID,
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, revisions)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+const revocationCacheTTL = 30 * time.Second
+
+// pgRevocationStore keeps the access token denylist in Postgres so that every
+// instance of the server sees it.
+type pgRevocationStore struct {
+	db *database.Queries
+}
+
+func (s pgRevocationStore) RevokeToken(ctx context.Context, tokenID string, userID uuid.UUID, expiresAt time.Time) error {
+	// Entries are only needed until the token would have expired anyway.
+	if err := s.db.DeleteExpiredRevokedAccessTokens(ctx); err != nil {
+		return err
+	}
+	return s.db.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{
+		TokenID:   tokenID,
+		UserID:    userID,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
+
+func (s pgRevocationStore) RevokeUser(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	return s.db.RevokeUserAccessTokens(ctx, database.RevokeUserAccessTokensParams{
+		UserID:        userID,
+		RevokedBefore: before.UTC(),
+	})
+}
+
+func (s pgRevocationStore) IsRevoked(ctx context.Context, tokenID string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	return s.db.IsAccessTokenRevoked(ctx, database.IsAccessTokenRevokedParams{
+		TokenID:  tokenID,
+		UserID:   userID,
+		IssuedAt: issuedAt.UTC(),
+	})
+}
+
+// revokeAccessTokens denies every access token issued to userID so far.
+func (cfg *apiConfig) revokeAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	// Postgres would round the cutoff to the microsecond, possibly down past a
+	// token issued in the same microsecond, so round it up instead.
+	before := time.Now().Truncate(time.Microsecond).Add(time.Microsecond)
+	return cfg.revocations.RevokeUser(ctx, userID, before)
+}
+
+// revokeSessionAccessTokens denies the access tokens issued in one session,
+// leaving the user's other sessions logged in.
+func (cfg *apiConfig) revokeSessionAccessTokens(ctx context.Context, userID, sessionID uuid.UUID) error {
+	tokens, err := cfg.db.ListSessionAccessTokens(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		err := cfg.revocations.RevokeToken(ctx, token.TokenID, userID, token.ExpiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+// adminSetRoleHandler changes a user's role. Access tokens carry the role, so
+// the ones already issued are revoked and the user has to refresh to pick up
+// the new role.
+func (cfg *apiConfig) adminSetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "role must be one of 'user', 'moderator' or 'admin'")
+		return
+	}
+	user, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: params.Role,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		errorString := "Error when attempting to update user's role"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.revokeAccessTokens(r.Context(), user.ID)
+	if err != nil {
+		errorString := "Something went wrong when attempting to revoke existing access tokens"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
+
+// runPromote implements the "promote <email> <role>" command, which is how the
+// first admin gets created.
+func runPromote(ctx context.Context, db *database.Queries, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: promote <email> <role>")
+	}
+	email, role := args[0], args[1]
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	user, err := db.SetUserRoleByEmail(ctx, database.SetUserRoleByEmailParams{
+		Email: email,
+		Role:  role,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user with email %q", email)
+		}
+		return err
+	}
+	fmt.Printf("%s is now %s\n", user.Email, user.Role)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+// rowDriver answers every query with the same single row, which is enough to
+// drive a handler whose only database call is one :one query.
+type rowDriver struct {
+	columns []string
+	row     []driver.Value
+}
+
+func (d rowDriver) Open(string) (driver.Conn, error) { return rowConn{d}, nil }
+
+func (d rowDriver) Connect(context.Context) (driver.Conn, error) { return rowConn{d}, nil }
+
+func (d rowDriver) Driver() driver.Driver { return d }
+
+type rowConn struct {
+	d rowDriver
+}
+
+func (c rowConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c rowConn) Close() error { return nil }
+
+func (c rowConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c rowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &rowRows{d: c.d}, nil
+}
+
+type rowRows struct {
+	d    rowDriver
+	done bool
+}
+
+func (r *rowRows) Columns() []string { return r.d.columns }
+
+func (r *rowRows) Close() error { return nil }
+
+func (r *rowRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.d.row)
+	return nil
+}
+
+func TestAdminSetRoleHandler_RevokesAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Now()
+	db := sql.OpenDB(rowDriver{
+		columns: []string{"id", "created_at", "updated_at", "email", "hashed_password", "role", "email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step"},
+		row:     []driver.Value{userID.String(), now, now, "user@example.com", "hash", "moderator", now, nil, nil, nil},
+	})
+	defer db.Close()
+	revocations := auth.NewMemoryRevocationStore()
+	cfg := &apiConfig{
+		db:          database.New(db),
+		revocations: revocations,
+	}
+	issuedAt := now.Add(-time.Minute)
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/"+userID.String()+"/role", strings.NewReader(`{"role":"moderator"}`))
+	req.SetPathValue("userID", userID.String())
+	rec := httptest.NewRecorder()
+	cfg.adminSetRoleHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var user User
+	if err := json.NewDecoder(rec.Body).Decode(&user); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if user.Role != "moderator" {
+		t.Errorf("expected role %q, got %q", "moderator", user.Role)
+	}
+	if !user.EmailVerified {
+		t.Errorf("expected email_verified to be true")
+	}
+	revoked, err := revocations.IsRevoked(ctx, "token", userID, issuedAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !revoked {
+		t.Errorf("access token issued before the role change should be revoked")
+	}
+}
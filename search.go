@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+	"github.com/Rota-of-light/HTTPServer/internal/search"
+)
+
+const (
+	maxSearchQueryLength = 256
+	maxSearchOffset      = 10000
+)
+
+// ChirpSearchResult carries a snippet of the chirp as escaped HTML with the
+// matched words in <mark> tags.
+type ChirpSearchResult struct {
+	Chirp
+	Snippet string  `json:"snippet"`
+	Rank    float32 `json:"rank"`
+}
+
+type ChirpSearchPage struct {
+	Results    []ChirpSearchResult `json:"results"`
+	NextOffset *int                `json:"next_offset"`
+}
+
+// searchChirpsHandler runs a ranked full-text search over chirp bodies. Results
+// are paged with limit and offset because rank order has no stable cursor.
+func (cfg *apiConfig) searchChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if utf8.RuneCountInString(q) > maxSearchQueryLength {
+		respondWithError(w, http.StatusBadRequest, "Search query is too long")
+		return
+	}
+	tsQuery, err := search.ToTSQuery(q)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Search query must contain at least one word")
+		return
+	}
+	if r.URL.Query().Has("cursor") {
+		respondWithError(w, http.StatusBadRequest, "Search results are paged with offset, not cursor")
+		return
+	}
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Postgres still ranks every skipped match, so deep offsets are refused.
+	var offset int64
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 32)
+		if err != nil || offset < 0 || offset > maxSearchOffset {
+			respondWithError(w, http.StatusBadRequest, "offset must be an integer from 0 to 10000")
+			return
+		}
+	}
+	rows, err := cfg.db.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:  tsQuery,
+		Offset: int32(offset),
+		Limit:  limit + 1,
+	})
+	if err != nil {
+		errorString := "Error when attempting to search chirps"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	res := ChirpSearchPage{Results: []ChirpSearchResult{}}
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		nextOffset := int(offset) + len(rows)
+		if nextOffset <= maxSearchOffset {
+			res.NextOffset = &nextOffset
+		}
+	}
+	for _, row := range rows {
+		res.Results = append(res.Results, ChirpSearchResult{
+			Chirp: chirpFromDB(database.Chirp{
+				ID:            row.ID,
+				CreatedAt:     row.CreatedAt,
+				UpdatedAt:     row.UpdatedAt,
+				Body:          row.Body,
+				UserID:        row.UserID,
+				ParentChirpID: row.ParentChirpID,
+			}),
+			Snippet: search.HighlightHTML(row.Snippet),
+			Rank:    row.Rank,
+		})
+	}
+	chirps := make([]*Chirp, 0, len(res.Results))
+	for i := range res.Results {
+		chirps = append(chirps, &res.Results[i].Chirp)
+	}
+	err = cfg.attachLikes(r.Context(), chirps, optionalViewer(r).ID)
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+const maxUserAgentLength = 512
+
+// Session is a login as seen by its user. Every refresh token issued by
+// rotating the one handed out at login belongs to the same session, so the
+// refresh token family ID doubles as the session ID.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+// clientIP returns the address the request came from. Forwarding headers are
+// ignored because nothing vouches for them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientUserAgent returns the User-Agent to store with a session. Postgres
+// rejects text that is not valid UTF-8, so bad bytes are replaced and the
+// cut is made on a rune boundary.
+func clientUserAgent(r *http.Request) string {
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "\uFFFD")
+	if len(userAgent) > maxUserAgentLength {
+		end := maxUserAgentLength
+		for end > 0 && !utf8.RuneStart(userAgent[end]) {
+			end--
+		}
+		userAgent = userAgent[:end]
+	}
+	return userAgent
+}
+
+func (cfg *apiConfig) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	rows, err := cfg.db.ListSessions(r.Context(), userID)
+	if err != nil {
+		errorString := "Error when attempting to retrive sessions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	sessions := make([]Session, len(rows))
+	for i, row := range rows {
+		sessions[i] = Session{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			UserAgent:  row.UserAgent,
+			IPAddress:  row.IpAddress,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// revokeSessionHandler logs out one session, including the access tokens
+// issued in it.
+func (cfg *apiConfig) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID format")
+		return
+	}
+	revoked, err := cfg.db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		errorString := "Something went wrong when trying to revoke session"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	err = cfg.revokeSessionAccessTokens(r.Context(), userID, sessionID)
+	if err != nil {
+		errorString := "Something went wrong when trying to revoke session"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllSessionsHandler logs the user out everywhere, including the access
+// tokens already handed out, and revokes their API keys unless
+// ?keep_api_keys=true is given.
+func (cfg *apiConfig) revokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	keepAPIKeys := r.URL.Query().Get("keep_api_keys") == "true"
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Something went wrong when trying to revoke sessions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	_, err = qtx.RevokeAllSessions(r.Context(), userID)
+	if err == nil && !keepAPIKeys {
+		err = qtx.RevokeAllAPIKeys(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Something went wrong when trying to revoke sessions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.revokeAccessTokens(r.Context(), userID)
+	if err != nil {
+		errorString := "Something went wrong when trying to revoke sessions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,23 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (token_id, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (token_id) DO NOTHING;
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens
+WHERE expires_at < NOW();
+
+-- name: RevokeUserAccessTokens :exec
+INSERT INTO access_token_cutoffs (user_id, revoked_before)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET revoked_before = GREATEST(access_token_cutoffs.revoked_before, EXCLUDED.revoked_before);
+
+-- name: IsAccessTokenRevoked :one
+SELECT (
+    EXISTS (SELECT 1 FROM revoked_access_tokens r WHERE r.token_id = sqlc.arg(token_id))
+    OR EXISTS (
+        SELECT 1 FROM access_token_cutoffs c
+        WHERE c.user_id = sqlc.arg(user_id) AND c.revoked_before > sqlc.arg(issued_at)
+    )
+)::boolean AS revoked;
@@ -1,3 +0,0 @@
--- name: AllChirps :many
-SELECT * FROM chirps
-ORDER BY created_at;
\ No newline at end of file
@@ -1,3 +1,3 @@
 -- name: CheckRevokeStatus :one
-SELECT revoked_at FROM refresh_tokens
-WHERE token = $1;
\ No newline at end of file
+SELECT revoked_at, user_id, family_id FROM refresh_tokens
+WHERE token_hash = $1;
\ No newline at end of file
@@ -0,0 +1,33 @@
+-- name: CreateChirpReport :one
+INSERT INTO chirp_reports (id, chirp_id, reporter_id, reason, status, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    'open',
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: ListChirpReports :many
+SELECT chirp_reports.*, chirps.body AS chirp_body, chirps.user_id AS chirp_user_id, chirps.hidden_at AS chirp_hidden_at
+FROM chirp_reports
+INNER JOIN chirps
+ON chirps.id = chirp_reports.chirp_id
+WHERE chirp_reports.status = $1
+ORDER BY chirp_reports.created_at;
+
+-- name: ResolveChirpReport :one
+UPDATE chirp_reports
+SET status = 'resolved', resolved_at = NOW(), resolved_by = $2, resolution = $3
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: SetChirpHidden :one
+UPDATE chirps
+SET hidden_at = CASE WHEN sqlc.arg('hidden')::boolean THEN COALESCE(hidden_at, NOW()) ELSE NULL END
+WHERE id = sqlc.arg('id')
+AND deleted_at IS NULL
+RETURNING *;
@@ -0,0 +1,36 @@
+-- name: AddChirpTag :exec
+INSERT INTO chirp_tags (chirp_id, tag)
+VALUES ($1, $2)
+ON CONFLICT (chirp_id, tag) DO NOTHING;
+
+-- name: DeleteChirpTags :exec
+DELETE FROM chirp_tags
+WHERE chirp_id = $1;
+
+-- name: ListChirpsByTag :many
+SELECT chirps.* FROM chirps
+INNER JOIN chirp_tags
+ON chirp_tags.chirp_id = chirps.id
+WHERE chirp_tags.tag = sqlc.arg('tag')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: TrendingTags :many
+SELECT chirp_tags.tag,
+    COUNT(*) AS chirp_count,
+    COUNT(DISTINCT chirps.user_id) AS author_count
+FROM chirp_tags
+INNER JOIN chirps
+ON chirps.id = chirp_tags.chirp_id
+WHERE chirps.created_at > sqlc.arg('since')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+GROUP BY chirp_tags.tag
+ORDER BY author_count DESC, chirp_count DESC, chirp_tags.tag
+LIMIT sqlc.arg('limit');
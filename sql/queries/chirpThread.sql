@@ -0,0 +1,24 @@
+-- name: GetChirpThread :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.parent_chirp_id FROM chirps
+    WHERE chirps.id = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT parent.id, parent.parent_chirp_id FROM chirps AS parent
+    INNER JOIN ancestors
+    ON parent.id = ancestors.parent_chirp_id
+),
+thread AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+        chirps.parent_chirp_id, chirps.deleted_at, chirps.hidden_at, 0 AS depth
+    FROM chirps
+    WHERE chirps.id = (SELECT ancestors.id FROM ancestors WHERE ancestors.parent_chirp_id IS NULL)
+    UNION ALL
+    SELECT reply.id, reply.created_at, reply.updated_at, reply.body, reply.user_id,
+        reply.parent_chirp_id, reply.deleted_at, reply.hidden_at, thread.depth + 1
+    FROM chirps AS reply
+    INNER JOIN thread
+    ON reply.parent_chirp_id = thread.id
+    WHERE thread.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, parent_chirp_id, deleted_at, hidden_at, depth FROM thread
+ORDER BY depth, created_at, id;
@@ -1,3 +1,21 @@
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: LockChirp :exec
+-- Held while deciding between DeleteChirp and TombstoneChirp: inserting a
+-- reply has to wait for it, since the foreign key check locks the parent.
+SELECT id FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: ChirpHasReplies :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE parent_chirp_id = $1
+);
@@ -1,3 +1,9 @@
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = sqlc.arg('id')
+AND deleted_at IS NULL
+AND (
+    hidden_at IS NULL
+    OR user_id = sqlc.narg('viewer_id')::uuid
+    OR sqlc.arg('viewer_is_moderator')::boolean
+);
\ No newline at end of file
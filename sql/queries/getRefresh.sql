@@ -1,4 +1,4 @@
--- name: GetRefreshByToken :one
+-- name: GetRefreshTokenForUpdate :one
 SELECT * FROM refresh_tokens
-WHERE token = $1
-AND revoked_at IS NULL;
\ No newline at end of file
+WHERE token_hash = $1
+FOR UPDATE;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- name: ListModerationWords :many
+SELECT word, action FROM moderation_words
+ORDER BY word;
@@ -0,0 +1,34 @@
+-- name: LockUserForPasswordReset :exec
+-- Serializes CreatePasswordResetToken for one user, so that concurrent
+-- requests each count the tokens the others created.
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CreatePasswordResetToken :execrows
+-- Creates nothing once the user already has max_recent tokens created after
+-- since.
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+SELECT sqlc.arg(token_hash)::text, sqlc.arg(user_id)::uuid, NOW(), sqlc.arg(expires_at)::timestamp
+WHERE (
+    SELECT COUNT(*) FROM password_reset_tokens recent
+    WHERE recent.user_id = sqlc.arg(user_id)::uuid AND recent.created_at > sqlc.arg(since)::timestamp
+) < sqlc.arg(max_recent)::bigint;
+
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
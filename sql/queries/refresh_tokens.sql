@@ -1,10 +1,34 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, last_used_at, user_id, expires_at, family_id, user_agent, ip_address, access_token_id, access_token_expires_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
+    NOW(),
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
 )
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: MarkRefreshTokenReplaced :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListSessionAccessTokens :many
+-- Access tokens issued in a session that have not expired yet.
+SELECT access_token_id::text AS token_id, access_token_expires_at::timestamp AS expires_at
+FROM refresh_tokens
+WHERE family_id = $1
+AND access_token_id IS NOT NULL
+AND access_token_expires_at > NOW();
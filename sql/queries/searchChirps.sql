@@ -0,0 +1,17 @@
+-- name: SearchChirps :many
+-- Matches in snippet are delimited by U+E000 and U+E001 (search.HighlightStart
+-- and HighlightStop) rather than markup, since the body is user-written.
+SELECT chirps.*,
+    ts_rank(chirps.search_vector, to_tsquery('english', sqlc.arg('query'))) AS rank,
+    ts_headline(
+        'english',
+        chirps.body,
+        to_tsquery('english', sqlc.arg('query')),
+        'StartSel=, StopSel=, MinWords=5, MaxWords=20'
+    )::text AS snippet
+FROM chirps
+WHERE chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirps.search_vector @@ to_tsquery('english', sqlc.arg('query'))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
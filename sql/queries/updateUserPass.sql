@@ -1,4 +1,7 @@
 -- name: UpdateUserPass :exec
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
+SET email = $2,
+    hashed_password = $3,
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
 WHERE id = $1;
\ No newline at end of file
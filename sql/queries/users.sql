@@ -7,4 +7,9 @@ VALUES (
     $1,
     $2
 )
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: UpgradePasswordHash :exec
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hash);
@@ -0,0 +1,50 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP DEFAULT NULL;
+
+-- Chirps flagged by the moderation chain are reports without a reporter, so
+-- the flag table becomes the report table and its rows stay open.
+ALTER TABLE chirp_flags
+RENAME TO chirp_reports;
+
+ALTER TABLE chirp_reports
+ADD COLUMN reporter_id UUID DEFAULT NULL,
+ADD COLUMN status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+ADD COLUMN resolved_at TIMESTAMP DEFAULT NULL,
+ADD COLUMN resolved_by UUID DEFAULT NULL,
+ADD COLUMN resolution TEXT DEFAULT NULL,
+ADD FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE SET NULL,
+ADD FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX chirp_reports_status_idx ON chirp_reports (status, created_at);
+
+-- A user may only have one open report against a chirp at a time.
+CREATE UNIQUE INDEX chirp_reports_open_reporter_idx ON chirp_reports (chirp_id, reporter_id)
+WHERE status = 'open' AND reporter_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirp_reports_open_reporter_idx;
+
+DROP INDEX chirp_reports_status_idx;
+
+DELETE FROM chirp_reports
+WHERE reporter_id IS NOT NULL OR status <> 'open';
+
+ALTER TABLE chirp_reports
+DROP COLUMN resolution,
+DROP COLUMN resolved_by,
+DROP COLUMN resolved_at,
+DROP COLUMN status,
+DROP COLUMN reporter_id;
+
+ALTER TABLE chirp_reports
+RENAME TO chirp_flags;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
+
+ALTER TABLE users
+DROP COLUMN is_admin;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Admins keep their access: the admin flag becomes the role column.
+ALTER TABLE users
+ALTER COLUMN is_admin DROP DEFAULT;
+
+ALTER TABLE users
+RENAME COLUMN is_admin TO role;
+
+ALTER TABLE users
+ALTER COLUMN role TYPE TEXT USING CASE WHEN role THEN 'admin' ELSE 'user' END,
+ALTER COLUMN role SET DEFAULT 'user',
+ADD CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- +goose Down
+-- Moderators have no admin flag to fall back to and become plain users.
+ALTER TABLE users
+DROP CONSTRAINT users_role_check,
+ALTER COLUMN role DROP DEFAULT;
+
+ALTER TABLE users
+ALTER COLUMN role TYPE BOOLEAN USING role = 'admin';
+
+ALTER TABLE users
+RENAME COLUMN role TO is_admin;
+
+ALTER TABLE users
+ALTER COLUMN is_admin SET DEFAULT false;
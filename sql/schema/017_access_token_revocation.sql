@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE revoked_access_tokens (
+    token_id TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE access_token_cutoffs (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE access_token_cutoffs;
+DROP TABLE revoked_access_tokens;
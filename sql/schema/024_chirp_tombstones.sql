@@ -0,0 +1,20 @@
+-- +goose Up
+-- Tombstones all have an empty body, so bodies only need to be unique among
+-- chirps that have not been deleted.
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_body_key;
+
+CREATE UNIQUE INDEX chirps_body_key ON chirps (body) WHERE deleted_at IS NULL;
+
+UPDATE chirps SET body = '' WHERE deleted_at IS NOT NULL;
+
+DELETE FROM chirp_revisions
+USING chirps
+WHERE chirp_revisions.chirp_id = chirps.id
+AND chirps.deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_body_key;
+
+ALTER TABLE chirps
+ADD CONSTRAINT chirps_body_key UNIQUE (body);
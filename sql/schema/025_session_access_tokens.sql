@@ -0,0 +1,11 @@
+-- +goose Up
+-- The access token issued together with each refresh token, so that revoking
+-- one session can revoke its access tokens without touching other sessions.
+ALTER TABLE refresh_tokens
+ADD COLUMN access_token_id TEXT,
+ADD COLUMN access_token_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN access_token_expires_at,
+DROP COLUMN access_token_id;
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/chirptext"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+	maxTrendingLimit      = 50
+)
+
+type TrendingTag struct {
+	Tag         string `json:"tag"`
+	ChirpCount  int64  `json:"chirp_count"`
+	AuthorCount int64  `json:"author_count"`
+}
+
+// storeChirpEntities records the hashtags and mentions found in a chirp's
+// body. q should be bound to the transaction that wrote the chirp. Mentions
+// of addresses that do not belong to a user are ignored.
+func storeChirpEntities(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	for _, tag := range chirptext.Hashtags(chirp.Body) {
+		err := q.AddChirpTag(ctx, database.AddChirpTagParams{
+			ChirpID: chirp.ID,
+			Tag:     tag,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	mentions := chirptext.Mentions(chirp.Body)
+	if len(mentions) == 0 {
+		return nil
+	}
+	users, err := q.GetUsersByEmails(ctx, mentions)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		err := q.AddChirpMention(ctx, database.AddChirpMentionParams{
+			ChirpID: chirp.ID,
+			UserID:  user.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) tagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Tag missing")
+		return
+	}
+	page, err := parsePageRequest(r, cursorTags, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dbChirps, err := cfg.db.ListChirpsByTag(r.Context(), database.ListChirpsByTagParams{
+		Tag:             tag,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive chirps for tag"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	chirps := make([]Chirp, len(dbChirps))
+	for i, chirp := range dbChirps {
+		chirps[i] = chirpFromDB(chirp)
+	}
+	err = cfg.attachLikesToPage(r.Context(), chirps, optionalViewer(r).ID)
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newChirpPage(chirps, page))
+}
+
+// trendingTagsHandler ranks the tags used within a sliding window, given as a
+// Go duration such as "6h". Tags are ranked by how many distinct users used
+// them so that a single account cannot push a tag up on its own.
+func (cfg *apiConfig) trendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingWindow
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		var err error
+		window, err = time.ParseDuration(windowStr)
+		if err != nil || window <= 0 {
+			respondWithError(w, http.StatusBadRequest, "window must be a positive duration such as 24h")
+			return
+		}
+		if window > maxTrendingWindow {
+			window = maxTrendingWindow
+		}
+	}
+	limit := defaultTrendingLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respondWithError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if limit > maxTrendingLimit {
+			limit = maxTrendingLimit
+		}
+	}
+	rows, err := cfg.db.TrendingTags(r.Context(), database.TrendingTagsParams{
+		Since: time.Now().UTC().Add(-window),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive trending tags"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	tags := make([]TrendingTag, len(rows))
+	for i, row := range rows {
+		tags[i] = TrendingTag{
+			Tag:         row.Tag,
+			ChirpCount:  row.ChirpCount,
+			AuthorCount: row.AuthorCount,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+func (cfg *apiConfig) mentionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	page, err := parsePageRequest(r, cursorMentions, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dbChirps, err := cfg.db.ListMentions(r.Context(), database.ListMentionsParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		Limit:           page.Limit + 1,
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive mentions"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	chirps := make([]Chirp, len(dbChirps))
+	for i, chirp := range dbChirps {
+		chirps[i] = chirpFromDB(chirp)
+	}
+	err = cfg.attachLikesToPage(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newChirpPage(chirps, page))
+}
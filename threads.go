@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+)
+
+const (
+	defaultThreadDepth = 10
+	maxThreadDepth     = 50
+)
+
+type ThreadChirp struct {
+	Chirp
+	Deleted bool          `json:"deleted"`
+	Hidden  bool          `json:"hidden"`
+	Replies []ThreadChirp `json:"replies"`
+}
+
+// chirpThreadHandler returns the whole conversation a chirp belongs to,
+// starting from the chirp that opened it. Deleted chirps that still have
+// replies are shown as tombstones with their body removed, as are hidden
+// chirps the caller is not allowed to see.
+func (cfg *apiConfig) chirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
+		return
+	}
+	depth := defaultThreadDepth
+	if depthStr := r.URL.Query().Get("depth"); depthStr != "" {
+		depth, err = strconv.Atoi(depthStr)
+		if err != nil || depth < 0 {
+			respondWithError(w, http.StatusBadRequest, "depth must be a non-negative integer")
+			return
+		}
+		if depth > maxThreadDepth {
+			depth = maxThreadDepth
+		}
+	}
+	rows, err := cfg.db.GetChirpThread(r.Context(), database.GetChirpThreadParams{
+		ChirpID:  chirpID,
+		MaxDepth: int32(depth),
+	})
+	if err != nil {
+		errorString := "Error when attempting to retrive thread"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if len(rows) == 0 {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	viewer := optionalViewer(r)
+	thread := buildThread(rows, viewer)
+	var chirps []*Chirp
+	var collect func(node *ThreadChirp)
+	collect = func(node *ThreadChirp) {
+		chirps = append(chirps, &node.Chirp)
+		for i := range node.Replies {
+			collect(&node.Replies[i])
+		}
+	}
+	collect(&thread)
+	err = cfg.attachLikes(r.Context(), chirps, viewer.ID)
+	if err != nil {
+		errorString := "Error when attempting to retrive likes"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, thread)
+}
+
+// buildThread turns the flat, depth-ordered rows of GetChirpThread into a tree.
+// The first row is always the root of the conversation.
+func buildThread(rows []database.GetChirpThreadRow, viewer chirpViewer) ThreadChirp {
+	children := make(map[uuid.UUID][]database.GetChirpThreadRow)
+	for _, row := range rows[1:] {
+		children[row.ParentChirpID.UUID] = append(children[row.ParentChirpID.UUID], row)
+	}
+	var build func(row database.GetChirpThreadRow) ThreadChirp
+	build = func(row database.GetChirpThreadRow) ThreadChirp {
+		node := ThreadChirp{
+			Chirp: chirpFromDB(database.Chirp{
+				ID:            row.ID,
+				CreatedAt:     row.CreatedAt,
+				UpdatedAt:     row.UpdatedAt,
+				Body:          row.Body,
+				UserID:        row.UserID,
+				ParentChirpID: row.ParentChirpID,
+			}),
+			Deleted: row.DeletedAt.Valid,
+			Hidden:  row.HiddenAt.Valid && !viewer.IsModerator && !(viewer.ID.Valid && viewer.ID.UUID == row.UserID),
+			Replies: []ThreadChirp{},
+		}
+		if node.Deleted || node.Hidden {
+			node.Body = ""
+		}
+		for _, child := range children[row.ID] {
+			node.Replies = append(node.Replies, build(child))
+		}
+		return node
+	}
+	return build(rows[0])
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+	"github.com/Rota-of-light/HTTPServer/internal/totp"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	mfaChallengeTTL   = 5 * time.Minute
+	maxMFAAttempts    = 5
+)
+
+// startMFAChallenge answers a correct password for an account with 2FA
+// enabled. The challenge token it hands out is exchanged for a session at
+// POST /api/login/mfa together with a code.
+func (cfg *apiConfig) startMFAChallenge(w http.ResponseWriter, r *http.Request, user database.User) {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		errorString := "Failure when attempting to create login challenge"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	expiresAt := time.Now().Add(mfaChallengeTTL)
+	// Challenges that were never answered are only needed until they expire.
+	err = cfg.db.DeleteExpiredMFAChallenges(r.Context())
+	if err == nil {
+		err = cfg.db.CreateMFAChallenge(r.Context(), database.CreateMFAChallengeParams{
+			TokenHash: auth.HashOpaqueToken(token),
+			UserID:    user.ID,
+			ExpiresAt: expiresAt,
+		})
+	}
+	if err != nil {
+		errorString := "Failure when attempting to create login challenge"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	type challenge struct {
+		MFARequired bool      `json:"mfa_required"`
+		MFAToken    string    `json:"mfa_token"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+	respondWithJSON(w, http.StatusOK, challenge{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// verifySecondFactor checks a TOTP code, refusing one that was already used,
+// or else a recovery code, which is used up. q should be bound to the
+// transaction that acts on the result.
+func verifySecondFactor(ctx context.Context, q *database.Queries, user database.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(user.TotpSecret.String, code, time.Now(), totpSkew)
+		if !ok {
+			return false, nil
+		}
+		used, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			ID:   user.ID,
+			Step: step,
+		})
+		return used == 1, err
+	}
+	if recoveryCode != "" {
+		used, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashOpaqueToken(totp.NormalizeRecoveryCode(recoveryCode)),
+			UserID:   user.ID,
+		})
+		return used == 1, err
+	}
+	return false, nil
+}
+
+func (cfg *apiConfig) loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Failure when attempting to check login challenge"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	tokenHash := auth.HashOpaqueToken(params.MFAToken)
+	challenge, err := qtx.GetMFAChallengeForUpdate(r.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "Login challenge not found")
+			return
+		}
+		errorString := "Failure when attempting to check login challenge"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if challenge.ExpiresAt.Before(time.Now()) || challenge.Attempts >= maxMFAAttempts {
+		err = qtx.DeleteMFAChallenge(r.Context(), tokenHash)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			errorString := "Failure when attempting to check login challenge"
+			respondWithError(w, http.StatusInternalServerError, errorString)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, "Login challenge expired, log in again")
+		return
+	}
+	user, err := qtx.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		errorString := "Failure when attempting to query for user data"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	wait, err := cfg.loginThrottle.Check(r.Context(), user.Email, clientIP(r))
+	if err != nil {
+		errorString := "Failure when attempting to check login attempts"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return
+	}
+	ok, err := verifySecondFactor(r.Context(), qtx, user, params.Code, params.RecoveryCode)
+	if err != nil {
+		errorString := "Failure when attempting to check authentication code"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if ok {
+		err = qtx.DeleteMFAChallenge(r.Context(), tokenHash)
+	} else {
+		err = qtx.RecordMFAChallengeFailure(r.Context(), tokenHash)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Failure when attempting to check authentication code"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if !ok {
+		// Wrong codes count like wrong passwords, so new challenges cannot
+		// be used to keep guessing.
+		wait, err := cfg.loginThrottle.RecordFailure(r.Context(), user.Email, clientIP(r))
+		if err != nil {
+			errorString := "Failure when attempting to record login attempt"
+			respondWithError(w, http.StatusInternalServerError, errorString)
+			return
+		}
+		if wait > 0 {
+			setRetryAfter(w, wait)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+	err = cfg.loginThrottle.RecordSuccess(r.Context(), user.Email)
+	if err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+	cfg.startSession(w, r, user)
+}
+
+// enrollTOTPHandler starts setting up 2FA by generating a secret. Nothing
+// changes at login until the secret is confirmed with a first code.
+func (cfg *apiConfig) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.db.GetUserByID(r.Context(), currentUserID(r))
+	if err != nil {
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		errorString := "Error when attempting to create two-factor secret"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	uri := totp.URI(totpIssuer, user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		errorString := "Error when attempting to create QR code"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.db.SetPendingTOTPSecret(r.Context(), database.SetPendingTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		errorString := "Error when attempting to store two-factor secret"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	type enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+		QRCodePNG  string `json:"qr_code_png"`
+	}
+	respondWithJSON(w, http.StatusOK, enrollment{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCodePNG:  base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// confirmTOTPHandler enables 2FA once the user proves their authenticator
+// works, and hands out recovery codes. They are only ever shown here.
+func (cfg *apiConfig) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), currentUserID(r))
+	if err != nil {
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "Start two-factor enrollment first")
+		return
+	}
+	step, ok := totp.Validate(user.TotpSecret.String, params.Code, time.Now(), totpSkew)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid authentication code")
+		return
+	}
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		errorString := "Error when attempting to create recovery codes"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Error when attempting to enable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	enabled, err := qtx.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		ID:           user.ID,
+		TotpSecret:   user.TotpSecret,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err == nil && enabled == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor enrollment changed, start again")
+		return
+	}
+	if err == nil {
+		err = storeRecoveryCodes(r.Context(), qtx, user.ID, codes)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Error when attempting to enable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	type confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithJSON(w, http.StatusOK, confirmation{RecoveryCodes: codes})
+}
+
+func storeRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID, codes []string) error {
+	err := q.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashOpaqueToken(code),
+			UserID:   userID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// disableTOTPHandler turns 2FA off. It asks for a code, or a recovery code,
+// so that a stolen access token alone cannot do it.
+func (cfg *apiConfig) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Error when attempting to disable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	user, err := qtx.GetUserByID(r.Context(), currentUserID(r))
+	if err != nil {
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+	wait, err := cfg.loginThrottle.Check(r.Context(), user.Email, clientIP(r))
+	if err != nil {
+		errorString := "Failure when attempting to check login attempts"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+		return
+	}
+	ok, err := verifySecondFactor(r.Context(), qtx, user, params.Code, params.RecoveryCode)
+	if err != nil {
+		errorString := "Failure when attempting to check authentication code"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if !ok {
+		// Counted with failed logins, so a stolen access token cannot be
+		// used to guess codes here instead.
+		wait, err := cfg.loginThrottle.RecordFailure(r.Context(), user.Email, clientIP(r))
+		if err != nil {
+			errorString := "Failure when attempting to record login attempt"
+			respondWithError(w, http.StatusInternalServerError, errorString)
+			return
+		}
+		if wait > 0 {
+			setRetryAfter(w, wait)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+	err = qtx.DisableTOTP(r.Context(), user.ID)
+	if err == nil {
+		err = qtx.DeleteRecoveryCodes(r.Context(), user.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		errorString := "Error when attempting to disable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = cfg.loginThrottle.RecordSuccess(r.Context(), user.Email)
+	if err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
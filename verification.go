@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rota-of-light/HTTPServer/internal/auth"
+	"github.com/Rota-of-light/HTTPServer/internal/database"
+	"github.com/Rota-of-light/HTTPServer/internal/mailer"
+)
+
+const (
+	emailVerificationTTL            = 24 * time.Hour
+	emailVerificationResendInterval = time.Minute
+)
+
+// loadMailer picks how email is delivered. MAIL_SMTP_ADDR (host:port) sends
+// through an SMTP relay, authenticating with MAIL_SMTP_USERNAME and
+// MAIL_SMTP_PASSWORD when set. Otherwise mail is appended to MAIL_LOG_FILE,
+// or written to stdout, so development needs no mail server.
+func loadMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <noreply@chirpy.local>"
+	}
+	if addr := os.Getenv("MAIL_SMTP_ADDR"); addr != "" {
+		return mailer.NewSMTPMailer(addr, from, os.Getenv("MAIL_SMTP_USERNAME"), os.Getenv("MAIL_SMTP_PASSWORD"))
+	}
+	if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+		return mailer.NewFileMailer(from, path)
+	}
+	return mailer.NewWriterMailer(from, os.Stdout), nil
+}
+
+// validEmail accepts a bare address such as "walt@example.com", without a
+// display name or angle brackets.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Name == "" && addr.Address == email
+}
+
+// createEmailVerification issues a token that verifies email for userID,
+// replacing any unused ones. q may be bound to a transaction.
+func createEmailVerification(ctx context.Context, q *database.Queries, userID uuid.UUID, email string) (string, error) {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = q.DeleteUnusedEmailVerificationTokens(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	err = q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashOpaqueToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendVerificationEmail mails token to email. Failures are only logged: the
+// account exists either way and the user can ask for another email.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, email, token string) {
+	var body strings.Builder
+	body.WriteString("Welcome to Chirpy!\n\n")
+	if cfg.publicURL != "" {
+		fmt.Fprintf(&body, "Confirm your email address by visiting %s/app/verify?token=%s\n\n", cfg.publicURL, token)
+	}
+	fmt.Fprintf(&body, "Your verification token is: %s\n\n", token)
+	fmt.Fprintf(&body, "It expires in %s. If you did not sign up, you can ignore this email.\n", emailVerificationTTL)
+	err := cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body:    body.String(),
+	})
+	if err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+}
+
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	if r.Body == nil {
+		respondWithError(w, http.StatusBadRequest, "Request body missing")
+		return
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong when decoding request")
+		return
+	}
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorString := "Error when attempting to verify email"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	verification, err := qtx.ConsumeEmailVerificationToken(r.Context(), auth.HashOpaqueToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Verification token is invalid or has expired")
+			return
+		}
+		errorString := "Error when attempting to verify email"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	user, err := qtx.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The user changed their address after the token was sent.
+			respondWithError(w, http.StatusBadRequest, "Verification token is invalid or has expired")
+			return
+		}
+		errorString := "Error when attempting to verify email"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		errorString := "Error when attempting to verify email"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
+
+func (cfg *apiConfig) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorString := "Something went wrong when attempting to retrieve user's information"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email address is already verified")
+		return
+	}
+	lastSent, err := cfg.db.LatestEmailVerificationTokenCreatedAt(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorString := "Error when attempting to send verification email"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	if err == nil {
+		if wait := time.Until(lastSent.Add(emailVerificationResendInterval)); wait > 0 {
+			w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+			respondWithError(w, http.StatusTooManyRequests, "A verification email was sent recently")
+			return
+		}
+	}
+	token, err := createEmailVerification(r.Context(), cfg.db, userID, user.Email)
+	if err != nil {
+		errorString := "Error when attempting to send verification email"
+		respondWithError(w, http.StatusInternalServerError, errorString)
+		return
+	}
+	cfg.sendVerificationEmail(r.Context(), user.Email, token)
+	w.WriteHeader(http.StatusAccepted)
+}